@@ -0,0 +1,206 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"image"
+	"math/bits"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	xdraw "golang.org/x/image/draw"
+)
+
+// dHash grid: each row compares 9 samples into 8 bits
+const (
+	hashWidth  = 9
+	hashHeight = 8
+)
+
+// imageHash computes a 64-bit difference hash of an image. Similar images
+// have hashes with a small Hamming distance.
+func imageHash(img image.Image) uint64 {
+	small := image.NewGray(image.Rect(0, 0, hashWidth, hashHeight))
+	xdraw.ApproxBiLinear.Scale(small, small.Bounds(), img, img.Bounds(), xdraw.Src, nil)
+
+	var hash uint64
+	for y := 0; y < hashHeight; y++ {
+		row := small.Pix[y*small.Stride : y*small.Stride+hashWidth]
+		for x := 0; x < hashWidth-1; x++ {
+			hash <<= 1
+			if row[x] < row[x+1] {
+				hash |= 1
+			}
+		}
+	}
+	return hash
+}
+
+// hashFile decodes an image file and computes its hash
+func hashFile(path string) (uint64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	img, _, err := image.Decode(file)
+	if err != nil {
+		return 0, fmt.Errorf("failed to decode image: %w", err)
+	}
+	return imageHash(img), nil
+}
+
+// hashDistance returns the number of differing bits between two hashes
+func hashDistance(a, b uint64) int {
+	return bits.OnesCount64(a ^ b)
+}
+
+// AdHash is a known ad or credit page
+type AdHash struct {
+	Hash    string    `json:"hash"` // dHash as 16 hex digits
+	AlbumID string    `json:"album_id"`
+	Page    int       `json:"page"`
+	AddedBy int64     `json:"added_by"`
+	AddedAt time.Time `json:"added_at"`
+}
+
+// AdLibrary is the local list of ad and credit page hashes
+type AdLibrary struct {
+	mu      sync.Mutex
+	path    string
+	entries []AdHash
+	hashes  []uint64
+}
+
+// LoadAdLibrary loads the library from path. A missing file gives an
+// empty library that is created on the first Add.
+func LoadAdLibrary(path string) (*AdLibrary, error) {
+	lib := &AdLibrary{path: path}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return lib, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(data, &lib.entries); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	for i, entry := range lib.entries {
+		hash, err := strconv.ParseUint(entry.Hash, 16, 64)
+		if err != nil {
+			return nil, fmt.Errorf("entry %d of %s: invalid hash %q", i+1, path, entry.Hash)
+		}
+		lib.hashes = append(lib.hashes, hash)
+	}
+
+	return lib, nil
+}
+
+// Len returns the number of known ad pages
+func (l *AdLibrary) Len() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.entries)
+}
+
+// Add records an ad page hash and saves the library.
+// It returns false if a matching hash is already known.
+func (l *AdLibrary) Add(hash uint64, albumID string, page int, addedBy int64, threshold int) (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.match(hash, threshold) {
+		return false, nil
+	}
+
+	l.entries = append(l.entries, AdHash{
+		Hash:    fmt.Sprintf("%016x", hash),
+		AlbumID: albumID,
+		Page:    page,
+		AddedBy: addedBy,
+		AddedAt: time.Now(),
+	})
+	l.hashes = append(l.hashes, hash)
+
+	data, err := json.MarshalIndent(l.entries, "", "  ")
+	if err != nil {
+		return false, err
+	}
+	if err := os.MkdirAll(filepath.Dir(l.path), 0755); err != nil {
+		return false, err
+	}
+	return true, os.WriteFile(l.path, data, 0644)
+}
+
+// Match reports whether a hash is within threshold bits of a known ad
+func (l *AdLibrary) Match(hash uint64, threshold int) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.match(hash, threshold)
+}
+
+// match is Match without locking
+func (l *AdLibrary) match(hash uint64, threshold int) bool {
+	for _, known := range l.hashes {
+		if hashDistance(hash, known) <= threshold {
+			return true
+		}
+	}
+	return false
+}
+
+// FilterPages hashes each page and drops known ad pages and pages that
+// repeat the previous page. Placeholders are always kept. It returns the
+// remaining pages and the page numbers that were removed.
+func FilterPages(images []DownloadedImage, lib *AdLibrary, config *Config) ([]DownloadedImage, []int) {
+	// Hashing every page is wasted work when nothing could be removed
+	checkAds := config.AdFilter && lib != nil && lib.Len() > 0
+	if !checkAds && !config.RemoveDuplicates {
+		return images, nil
+	}
+
+	kept := make([]DownloadedImage, 0, len(images))
+	removed := make([]int, 0)
+
+	var prev uint64
+	hasPrev := false
+	for _, img := range images {
+		if img.Missing {
+			kept = append(kept, img)
+			hasPrev = false
+			continue
+		}
+
+		hash, err := hashFile(img.Path)
+		if err != nil {
+			// Let the PDF stage decide what to do with unreadable pages
+			kept = append(kept, img)
+			hasPrev = false
+			continue
+		}
+		img.Hash = hash
+
+		isAd := checkAds && lib.Match(hash, config.AdHashThreshold)
+		isDuplicate := config.RemoveDuplicates && hasPrev && hashDistance(hash, prev) <= config.AdHashThreshold
+		prev, hasPrev = hash, true
+
+		if isAd || isDuplicate {
+			removed = append(removed, img.Index+1)
+			continue
+		}
+		kept = append(kept, img)
+	}
+
+	// Never remove every page
+	if len(kept) == 0 {
+		return images, nil
+	}
+	return kept, removed
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+)
+
+func TestFilterPagesSkipsHashingWhenNothingToRemove(t *testing.T) {
+	images := writeTestAlbum(t, t.TempDir(), 3, 40, 60)
+	lib, err := LoadAdLibrary(filepath.Join(t.TempDir(), "ads.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config := DefaultConfig()
+	config.AdFilter = true
+	config.RemoveDuplicates = false
+	for _, l := range []*AdLibrary{nil, lib} {
+		kept, removed := FilterPages(images, l, config)
+		if len(kept) != len(images) || len(removed) != 0 {
+			t.Fatalf("kept %d pages and removed %v, want all pages kept", len(kept), removed)
+		}
+		for _, img := range kept {
+			if img.Hash != 0 {
+				t.Fatalf("page %d was hashed", img.Index+1)
+			}
+		}
+	}
+
+	// The pages are identical, so duplicate removal keeps only the first
+	config.RemoveDuplicates = true
+	kept, removed := FilterPages(images, lib, config)
+	if len(kept) != 1 || len(removed) != 2 {
+		t.Fatalf("kept %d pages and removed %v, want 1 kept and 2 removed", len(kept), removed)
+	}
+}
+
+func TestCreatePDFNamesFilesAfterRemovedPages(t *testing.T) {
+	dir := t.TempDir()
+	comic := &Comic{ID: "ads", Chapters: []Chapter{{ImageURLs: make([]string, 4)}}}
+	albumDir := filepath.Join(dir, comic.ID)
+	if err := os.MkdirAll(albumDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	images := writeTestAlbum(t, albumDir, 4, 40, 60)
+	config := DefaultConfig()
+	config.BaseDir = dir
+
+	build := func(images []DownloadedImage) (string, []string) {
+		gen := NewPDFGenerator(config)
+		files, err := gen.CreatePDF(context.Background(), comic, images)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return files[0], gen.Created()
+	}
+
+	all, _ := build(images)
+	if filepath.Base(all) != "ads.pdf" {
+		t.Errorf("PDF with every page named %s, want ads.pdf", filepath.Base(all))
+	}
+
+	// A page newly added to the ad library must not be served from the
+	// PDF built before
+	withoutAd := append(append([]DownloadedImage(nil), images[:2]...), images[3:]...)
+	filtered, created := build(withoutAd)
+	if filtered == all || len(created) != 1 {
+		t.Fatalf("PDF without page 3 is %s (created %v), want a new file", filtered, created)
+	}
+	if n, err := api.PageCountFile(filtered); err != nil || n != 3 {
+		t.Fatalf("page count %d (%v), want 3", n, err)
+	}
+
+	// The same pages removed again reuse that file
+	if again, created := build(withoutAd); again != filtered || len(created) != 0 {
+		t.Errorf("rebuilt %s (created %v), want the cached %s", again, created, filtered)
+	}
+}
@@ -0,0 +1,263 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"image"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// cliCommands are the offline commands that run without the plugin SDK
+var cliCommands = map[string]func(args []string) error{
+	"descramble": runDescrambleCommand,
+	"pdf":        runPDFCommand,
+}
+
+// runCLI runs an offline command if args name one and reports whether it did
+func runCLI(args []string) (bool, int) {
+	if len(args) == 0 {
+		return false, 0
+	}
+	command, ok := cliCommands[args[0]]
+	if !ok {
+		return false, 0
+	}
+
+	if err := command(args[1:]); err != nil {
+		if err != flag.ErrHelp {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", args[0], err)
+		}
+		return true, 1
+	}
+	return true, 0
+}
+
+// runDescrambleCommand restores the scrambled images of one chapter.
+// Images must keep their original JM file names, which the scramble
+// number is derived from.
+func runDescrambleCommand(args []string) error {
+	fs := flag.NewFlagSet("descramble", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: showmejm descramble <dir> --photo-id N [options]")
+		fs.PrintDefaults()
+	}
+	photoID := fs.Int("photo-id", 0, "Chapter (photo) ID the images belong to")
+	scrambleID := fs.Int("scramble-id", SCRAMBLE_220980, "Scramble ID of the chapter page")
+	outDir := fs.String("out", "", "Output directory (default <dir>/decoded)")
+	configPath := fs.String("config", defaultConfigPath(), "Config file for image quality and scramble rules")
+
+	dir, err := parseCLIArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if *photoID <= 0 {
+		fs.Usage()
+		return fmt.Errorf("--photo-id is required")
+	}
+	if *outDir == "" {
+		*outDir = filepath.Join(dir, "decoded")
+	}
+
+	config, err := readCLIConfig(*configPath)
+	if err != nil {
+		return err
+	}
+	client := &JMClient{config: config}
+	chapter := &Chapter{
+		ID:         strconv.Itoa(*photoID),
+		ScrambleID: strconv.Itoa(*scrambleID),
+	}
+
+	files, err := listImageFiles(dir)
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		return fmt.Errorf("no images found in %s", dir)
+	}
+	if err := os.MkdirAll(*outDir, 0755); err != nil {
+		return err
+	}
+
+	failed := 0
+	for _, path := range files {
+		name := filepath.Base(path)
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+
+		decoded, err := client.DecodeScrambledImage(data, chapter, name)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", name, err)
+			failed++
+			continue
+		}
+
+		// Name the output after its content, which may have been re-encoded
+		_, format, err := image.DecodeConfig(bytes.NewReader(decoded))
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		outPath := filepath.Join(*outDir, strings.TrimSuffix(name, filepath.Ext(name))+imageExt(format))
+		if err := os.WriteFile(outPath, decoded, 0644); err != nil {
+			return err
+		}
+
+		segments := client.GetScrambleNum(chapter.ScrambleID, chapter.ID, name)
+		fmt.Printf("%s -> %s (%d segments)\n", name, outPath, segments)
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d images failed", failed, len(files))
+	}
+	return nil
+}
+
+// runPDFCommand builds PDFs from a directory of downloaded pages
+func runPDFCommand(args []string) error {
+	fs := flag.NewFlagSet("pdf", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: showmejm pdf <dir> [options]")
+		fs.PrintDefaults()
+	}
+	outDir := fs.String("out", "", "Base directory; PDFs are written to <out>/<dir name>/ (default: next to the pages in <dir>)")
+	force := fs.Bool("force", false, "Replace PDFs that already exist")
+	configPath := fs.String("config", defaultConfigPath(), "Config file for PDF settings")
+
+	dir, err := parseCLIArgs(fs, args)
+	if err != nil {
+		return err
+	}
+
+	config, err := readCLIConfig(*configPath)
+	if err != nil {
+		return err
+	}
+
+	// CreatePDF writes to <BaseDir>/<comic ID>, so the directory name
+	// stands in for the comic ID
+	comic := &Comic{ID: filepath.Base(filepath.Clean(dir))}
+	config.BaseDir = filepath.Dir(filepath.Clean(dir))
+	if *outDir != "" {
+		config.BaseDir = *outDir
+	}
+	generator := NewPDFGenerator(config)
+	generator.SetLogger(func(level, message string) {
+		fmt.Fprintf(os.Stderr, "[%s] %s\n", level, message)
+	})
+
+	if *force {
+		generator.CleanupPDF(comic)
+	}
+
+	files, err := listImageFiles(dir)
+	if err != nil {
+		return err
+	}
+	images := make([]DownloadedImage, 0, len(files))
+	for _, path := range files {
+		info, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+		name := filepath.Base(path)
+		images = append(images, DownloadedImage{
+			Index:    imageIndex(name),
+			Path:     path,
+			Size:     info.Size(),
+			Filename: name,
+			Missing:  strings.HasSuffix(name, placeholderExt),
+		})
+	}
+
+	pdfFiles, err := createPDF(context.Background(), generator, comic, images)
+	if err != nil {
+		return err
+	}
+	for _, pdfPath := range pdfFiles {
+		fmt.Println(pdfPath)
+	}
+	return nil
+}
+
+// parseCLIArgs parses flags given before or after the directory argument
+// and returns the directory
+func parseCLIArgs(fs *flag.FlagSet, args []string) (string, error) {
+	if err := fs.Parse(args); err != nil {
+		return "", err
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return "", fmt.Errorf("missing directory")
+	}
+
+	dir := fs.Arg(0)
+	if err := fs.Parse(fs.Args()[1:]); err != nil {
+		return "", err
+	}
+	if fs.NArg() > 0 {
+		return "", fmt.Errorf("unexpected argument %q", fs.Arg(0))
+	}
+
+	if info, err := os.Stat(dir); err != nil {
+		return "", err
+	} else if !info.IsDir() {
+		return "", fmt.Errorf("%s is not a directory", dir)
+	}
+	return dir, nil
+}
+
+// readCLIConfig reads the config file if it exists and falls back to the
+// defaults otherwise
+func readCLIConfig(path string) (*Config, error) {
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return DefaultConfig(), nil
+	}
+	config, err := ReadConfig(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config %s: %w", path, err)
+	}
+	return config, nil
+}
+
+// listImageFiles returns the image files in dir sorted by page index
+func listImageFiles(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	files := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		switch strings.ToLower(filepath.Ext(entry.Name())) {
+		case ".jpg", ".jpeg", ".png", ".webp", ".gif":
+			files = append(files, filepath.Join(dir, entry.Name()))
+		}
+	}
+
+	sort.SliceStable(files, func(i, j int) bool {
+		a, b := filepath.Base(files[i]), filepath.Base(files[j])
+		if ia, ib := imageIndex(a), imageIndex(b); ia != ib {
+			return ia < ib
+		}
+		return a < b
+	})
+	return files, nil
+}
+
+// imageIndex extracts the page number a file name starts with
+func imageIndex(name string) int {
+	index := 0
+	fmt.Sscanf(name, "%d", &index)
+	return index
+}
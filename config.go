@@ -2,25 +2,57 @@ package main
 
 import (
 	"encoding/json"
+	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 )
 
 // Config holds plugin configuration
 type Config struct {
 	// Download settings
 	BaseDir     string `json:"base_dir"`      // Download directory
-	BatchSize   int    `json:"batch_size"`    // Images per batch for download
+	BatchSize   int    `json:"batch_size"`    // Max images of one comic downloading at once
 	PDFMaxPages int    `json:"pdf_max_pages"` // Max pages per PDF file
 
+	// Splitting into several PDFs
+	PDFSplit         string `json:"pdf_split"`          // "pages", "size" or "chapter", see the PDFSplit constants
+	PDFMaxSizeMB     int    `json:"pdf_max_size_mb"`    // Max MB of images per PDF when splitting by size (0 means no limit)
+	PDFGroupChapters bool   `json:"pdf_group_chapters"` // Put consecutive chapters in one PDF up to the limits when splitting by chapter
+
+	// Size budget
+	PDFTargetSizeMB int  `json:"pdf_target_size_mb"` // Recompress PDFs larger than this many MB (0 means no limit)
+	TargetDownscale bool `json:"target_downscale"`   // Also downscale pages when quality alone is not enough
+
+	// Title page
+	TitlePage bool   `json:"title_page"` // Start every PDF with a page showing the cover and album details
+	TitleFont string `json:"title_font"` // TrueType/OpenType font for the title page, needs CJK glyphs for Chinese titles
+
 	// Image compression settings
 	ImageQuality int `json:"image_quality"` // JPEG compression quality (1-100, 0 means no compression)
 
+	// Image processing applied while building PDFs
+	Processing ImageProcessing `json:"processing"`
+
+	// Page filtering before building PDFs
+	AdFilter         bool   `json:"ad_filter"`         // Remove pages matching the ad library
+	RemoveDuplicates bool   `json:"remove_duplicates"` // Remove pages that repeat the previous page
+	AdHashThreshold  int    `json:"ad_hash_threshold"` // Max differing hash bits for pages to count as equal
+	AdLibrary        string `json:"ad_library"`        // File of known ad and credit page hashes
+
 	// Feature flags
-	AutoFindJM     bool   `json:"auto_find_jm"`     // Auto-find JM numbers in messages
-	PreventDefault bool   `json:"prevent_default"`  // Stop other plugins from handling
-	PDFPassword    string `json:"pdf_password"`     // PDF encryption password (for display only)
-	CleanupAfter   bool   `json:"cleanup_after"`    // Delete images after PDF creation
+	AutoFindJM     bool   `json:"auto_find_jm"`    // Auto-find JM numbers in messages
+	PreventDefault bool   `json:"prevent_default"` // Stop other plugins from handling
+	PDFPassword    string `json:"pdf_password"`    // PDF encryption password (for display only)
+	CleanupAfter   bool   `json:"cleanup_after"`   // Delete images after PDF creation
+	CancelCleanup  bool   `json:"cancel_cleanup"`  // Delete the files a cancelled download created
+
+	// PDF encryption, applied if pdf_password or pdf_owner_password is set
+	PDFOwnerPassword string `json:"pdf_owner_password"` // Password for full access (empty means pdf_password)
+	PDFNoPrint       bool   `json:"pdf_no_print"`       // Forbid printing without the owner password
+	PDFNoCopy        bool   `json:"pdf_no_copy"`        // Forbid copying or extracting images and text
+	PDFNoModify      bool   `json:"pdf_no_modify"`      // Forbid editing, annotating and assembling pages
+	PDFKeyLength     int    `json:"pdf_key_length"`     // AES key length in bits, 128 or 256
 
 	// Whitelist (empty means allow all)
 	PersonWhitelist []int64 `json:"person_whitelist"` // Person whitelist
@@ -28,7 +60,88 @@ type Config struct {
 
 	// JM API settings
 	JMDomains          []string `json:"jm_domains"`          // Available JM domains
-	ConcurrentDownload int      `json:"concurrent_download"` // Max concurrent image downloads
+	ConcurrentDownload int      `json:"concurrent_download"` // Size of the shared download worker pool
+	MaxConcurrentJobs  int      `json:"max_concurrent_jobs"` // Max comics downloading at once, others wait in queue
+	ProgressInterval   int      `json:"progress_interval"`   // Seconds between progress messages (0 disables)
+	ImageRetries       int      `json:"image_retries"`       // Retry rounds for failed images after the first pass
+	MaxMissingPages    int      `json:"max_missing_pages"`   // Failed images replaced by placeholders before aborting
+	MemoryBudgetMB     int      `json:"memory_budget_mb"`    // Max MB of image data decoded at once (0 means no limit)
+	MinImageSize       int      `json:"min_image_size"`      // Images narrower or shorter than this (px) are treated as corrupt
+	BandwidthLimitKB   int      `json:"bandwidth_limit_kb"`  // Total image download speed limit in KB/s (0 means no limit)
+	SmallAlbumPages    int      `json:"small_album_pages"`   // Albums up to this many pages jump ahead in the queue
+
+	// Admins get priority downloads and can manage other users' jobs
+	Admins []int64 `json:"admins"`
+
+	// Scramble eras, sorted by photo ID (empty means the built-in table)
+	ScrambleRules []ScrambleRule `json:"scramble_rules"`
+
+	// Per-group overrides, keyed by group ID
+	GroupSettings map[int64]*GroupSettings `json:"group_settings"`
+}
+
+// ImageProcessing configures the optional page processing stage
+type ImageProcessing struct {
+	TrimBorders bool `json:"trim_borders"` // Trim uniform white or black borders
+	MaxWidth    int  `json:"max_width"`    // Downsize pages wider than this (0 means no limit)
+	MaxHeight   int  `json:"max_height"`   // Downsize pages taller than this (0 means no limit)
+	Grayscale   bool `json:"grayscale"`    // Store pages without color as single-channel images
+
+	Spreads          string `json:"spreads"`           // "split" two-page spreads, "merge" facing pages, or "" to keep pages as they are
+	ReadingDirection string `json:"reading_direction"` // "rtl" (right to left) or "ltr", orders split and merged pages; empty orders them right to left without setting the viewer direction
+
+	LongStrip      string  `json:"long_strip"`       // "off" (default) keeps pages as they are, "on" stitches them, "auto" detects vertical-scroll comics
+	StripPageRatio float64 `json:"strip_page_ratio"` // Height to width ratio of pages cut from a long strip
+
+	PageLayout  string `json:"page_layout"`  // "a4" fits pages into A4 at 150 DPI, "original" keeps the pixel size, "width" scales to page_width
+	PageWidth   int    `json:"page_width"`   // Page width in pixels for the "width" layout
+	PageDisplay string `json:"page_display"` // "single", or "two" to open PDFs as facing pages in reading direction
+}
+
+// PDF split strategies
+const (
+	PDFSplitPages   = "pages"   // At most pdf_max_pages pages per file
+	PDFSplitSize    = "size"    // At most pdf_max_size_mb of images per file
+	PDFSplitChapter = "chapter" // One file per chapter, or grouped chapters within the limits
+)
+
+// Spread modes
+const (
+	SpreadsSplit = "split"
+	SpreadsMerge = "merge"
+)
+
+// Long-strip modes
+const (
+	LongStripAuto = "auto"
+	LongStripOn   = "on"
+	LongStripOff  = "off"
+)
+
+// Page layouts
+const (
+	PageLayoutA4       = "a4"
+	PageLayoutOriginal = "original"
+	PageLayoutWidth    = "width"
+)
+
+// Page display modes
+const (
+	PageDisplaySingle = "single"
+	PageDisplayTwo    = "two"
+)
+
+// Reading directions
+const (
+	ReadingRTL = "rtl"
+	ReadingLTR = "ltr"
+)
+
+// GroupSettings overrides settings for one group. Nil fields keep the
+// global value, and fields missing from a group's processing block keep
+// the global processing setting.
+type GroupSettings struct {
+	Processing *ImageProcessing `json:"processing,omitempty"`
 }
 
 // DefaultConfig returns default configuration
@@ -37,21 +150,51 @@ func DefaultConfig() *Config {
 		BaseDir:            "/shared-data/jmDownload", // Shared directory with napcat container
 		BatchSize:          20,
 		PDFMaxPages:        200,
+		PDFSplit:           PDFSplitPages,
 		ImageQuality:       0, // 0 means no compression, 1-100 for JPEG quality
 		AutoFindJM:         true,
 		PreventDefault:     true,
 		PDFPassword:        "",
+		PDFKeyLength:       256,
 		CleanupAfter:       false,
+		CancelCleanup:      false,
 		PersonWhitelist:    []int64{},
 		GroupWhitelist:     []int64{},
 		JMDomains:          []string{},
 		ConcurrentDownload: 10,
+		MaxConcurrentJobs:  2,
+		ProgressInterval:   60,
+		ImageRetries:       2,
+		MaxMissingPages:    3,
+		MemoryBudgetMB:     512,
+		MinImageSize:       50,
+		BandwidthLimitKB:   0,
+		SmallAlbumPages:    50,
+		Admins:             []int64{},
+		ScrambleRules:      DefaultScrambleRules(),
+		AdFilter:           true,
+		RemoveDuplicates:   false,
+		AdHashThreshold:    5,
+		AdLibrary:          filepath.Join("plugins-config", "showmejm", "ad_hashes.json"),
+		GroupSettings:      map[int64]*GroupSettings{},
+		Processing: ImageProcessing{
+			LongStrip:      LongStripOff,
+			StripPageRatio: defaultStripPageRatio,
+			PageLayout:     PageLayoutA4,
+			PageWidth:      defaultPageWidth,
+			PageDisplay:    PageDisplaySingle,
+		},
 	}
 }
 
+// defaultConfigPath returns the plugin's config file path
+func defaultConfigPath() string {
+	return filepath.Join("plugins-config", "showmejm", "config.json")
+}
+
 // LoadConfig loads configuration from file
 func LoadConfig() (*Config, error) {
-	configPath := filepath.Join("plugins-config", "showmejm", "config.json")
+	configPath := defaultConfigPath()
 
 	// Create config directory if not exists
 	configDir := filepath.Dir(configPath)
@@ -69,7 +212,23 @@ func LoadConfig() (*Config, error) {
 	}
 
 	// Load existing config
-	data, err := os.ReadFile(configPath)
+	config, err := ReadConfig(configPath)
+	if err != nil {
+		return nil, err
+	}
+
+	// Create base directory if not exists
+	if err := os.MkdirAll(config.BaseDir, 0755); err != nil {
+		return nil, err
+	}
+
+	return config, nil
+}
+
+// ReadConfig reads a configuration file and fills in defaults without
+// creating any files or directories
+func ReadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
 	if err != nil {
 		return nil, err
 	}
@@ -78,11 +237,86 @@ func LoadConfig() (*Config, error) {
 	if err := json.Unmarshal(data, config); err != nil {
 		return nil, err
 	}
+	if err := mergeGroupProcessing(config, data); err != nil {
+		return nil, err
+	}
 
 	// Ensure default values for new fields
 	if config.ConcurrentDownload <= 0 {
 		config.ConcurrentDownload = 10
 	}
+	if config.BatchSize <= 0 {
+		config.BatchSize = 20
+	}
+	if config.MaxConcurrentJobs <= 0 {
+		config.MaxConcurrentJobs = 2
+	}
+	if config.ProgressInterval < 0 {
+		config.ProgressInterval = 0
+	}
+	if config.ImageRetries < 0 {
+		config.ImageRetries = 0
+	}
+	if config.MaxMissingPages < 0 {
+		config.MaxMissingPages = 0
+	}
+	if config.MemoryBudgetMB < 0 {
+		config.MemoryBudgetMB = 0
+	}
+	if config.MinImageSize < 0 {
+		config.MinImageSize = 0
+	}
+	if config.BandwidthLimitKB < 0 {
+		config.BandwidthLimitKB = 0
+	}
+	if config.PDFTargetSizeMB < 0 {
+		config.PDFTargetSizeMB = 0
+	}
+	if config.PDFKeyLength != 128 {
+		config.PDFKeyLength = 256
+	}
+	// Whoever can open the PDF with the owner password may ignore the
+	// permission flags
+	if (config.PDFNoPrint || config.PDFNoCopy || config.PDFNoModify) &&
+		(config.PDFOwnerPassword == "" || config.PDFOwnerPassword == config.PDFPassword) {
+		return nil, fmt.Errorf("pdf_no_print, pdf_no_copy and pdf_no_modify need a pdf_owner_password different from pdf_password")
+	}
+	// The built-in font cannot draw Chinese titles, so most title pages
+	// would be skipped without one
+	if config.TitlePage {
+		if err := checkTitleFont(config.TitleFont); err != nil {
+			return nil, fmt.Errorf("title_page needs a title_font with CJK glyphs: %w", err)
+		}
+	}
+	if config.PDFMaxSizeMB < 0 {
+		config.PDFMaxSizeMB = 0
+	}
+	switch config.PDFSplit {
+	case PDFSplitPages, PDFSplitSize, PDFSplitChapter:
+	default:
+		config.PDFSplit = PDFSplitPages
+	}
+	if config.AdHashThreshold < 0 {
+		config.AdHashThreshold = 0
+	}
+	if config.AdLibrary == "" {
+		config.AdLibrary = DefaultConfig().AdLibrary
+	}
+
+	// Validate scramble rules
+	if len(config.ScrambleRules) == 0 {
+		config.ScrambleRules = DefaultScrambleRules()
+	} else if err := ValidateScrambleRules(config.ScrambleRules); err != nil {
+		return nil, fmt.Errorf("invalid scramble_rules: %w", err)
+	}
+
+	// Validate processing limits
+	config.Processing.normalize()
+	for _, settings := range config.GroupSettings {
+		if settings != nil && settings.Processing != nil {
+			settings.Processing.normalize()
+		}
+	}
 
 	// Validate image quality range
 	if config.ImageQuality < 0 {
@@ -91,11 +325,6 @@ func LoadConfig() (*Config, error) {
 		config.ImageQuality = 100
 	}
 
-	// Create base directory if not exists
-	if err := os.MkdirAll(config.BaseDir, 0755); err != nil {
-		return nil, err
-	}
-
 	return config, nil
 }
 
@@ -130,6 +359,165 @@ func (c *Config) CheckWhitelist(isGroup bool, id int64) bool {
 	return false
 }
 
+// mergeGroupProcessing reads each group's processing block over a copy of
+// the global one, so fields a group leaves out keep their global values
+func mergeGroupProcessing(config *Config, data []byte) error {
+	var raw struct {
+		GroupSettings map[int64]struct {
+			Processing json.RawMessage `json:"processing"`
+		} `json:"group_settings"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	for groupID, group := range raw.GroupSettings {
+		settings := config.GroupSettings[groupID]
+		if settings == nil || len(group.Processing) == 0 || string(group.Processing) == "null" {
+			continue
+		}
+		processing := config.Processing
+		if err := json.Unmarshal(group.Processing, &processing); err != nil {
+			return fmt.Errorf("group %d: %w", groupID, err)
+		}
+		settings.Processing = &processing
+	}
+	return nil
+}
+
+// IsAdmin checks if a user is a plugin admin
+func (c *Config) IsAdmin(userID int64) bool {
+	for _, id := range c.Admins {
+		if id == userID {
+			return true
+		}
+	}
+	return false
+}
+
+// ForGroup returns the configuration with a group's overrides applied
+func (c *Config) ForGroup(groupID int64) *Config {
+	settings := c.GroupSettings[groupID]
+	if settings == nil {
+		return c
+	}
+
+	config := *c
+	if settings.Processing != nil {
+		config.Processing = *settings.Processing
+	}
+	return &config
+}
+
+// EncryptsPDF reports whether generated PDFs are encrypted
+func (c *Config) EncryptsPDF() bool {
+	return c.PDFPassword != "" || c.PDFOwnerPassword != ""
+}
+
+// JPEGQuality returns the quality used when a page has to be re-encoded
+// as JPEG: the configured compression quality, or 95 without compression
+func (c *Config) JPEGQuality() int {
+	if c.ImageQuality > 0 && c.ImageQuality < 100 {
+		return c.ImageQuality
+	}
+	return 95
+}
+
+// normalize clamps invalid processing limits
+func (s *ImageProcessing) normalize() {
+	if s.MaxWidth < 0 {
+		s.MaxWidth = 0
+	}
+	if s.MaxHeight < 0 {
+		s.MaxHeight = 0
+	}
+
+	s.Spreads = strings.ToLower(s.Spreads)
+	if s.Spreads != SpreadsSplit && s.Spreads != SpreadsMerge {
+		s.Spreads = ""
+	}
+	s.ReadingDirection = strings.ToLower(s.ReadingDirection)
+	if s.ReadingDirection != ReadingRTL && s.ReadingDirection != ReadingLTR {
+		s.ReadingDirection = ""
+	}
+
+	s.LongStrip = strings.ToLower(s.LongStrip)
+	if s.LongStrip != LongStripOn && s.LongStrip != LongStripAuto {
+		s.LongStrip = LongStripOff
+	}
+	if s.StripPageRatio <= 0 {
+		s.StripPageRatio = defaultStripPageRatio
+	}
+
+	s.PageLayout = strings.ToLower(s.PageLayout)
+	if s.PageLayout != PageLayoutOriginal && s.PageLayout != PageLayoutWidth {
+		s.PageLayout = PageLayoutA4
+	}
+	if s.PageWidth <= 0 {
+		s.PageWidth = defaultPageWidth
+	}
+	s.PageDisplay = strings.ToLower(s.PageDisplay)
+	if s.PageDisplay != PageDisplayTwo {
+		s.PageDisplay = PageDisplaySingle
+	}
+}
+
+// RightToLeft reports whether split and merged pages are ordered from
+// right to left, the manga order unless ltr is set
+func (s ImageProcessing) RightToLeft() bool {
+	return s.ReadingDirection != ReadingLTR
+}
+
+// ViewerRightToLeft reports whether PDF viewers are told to page from
+// right to left, which only an explicit rtl setting does
+func (s ImageProcessing) ViewerRightToLeft() bool {
+	return s.ReadingDirection == ReadingRTL
+}
+
+// Enabled reports whether any per-page pixel processing is configured
+func (s ImageProcessing) Enabled() bool {
+	return s.TrimBorders || s.MaxWidth > 0 || s.MaxHeight > 0 || s.Grayscale
+}
+
+// Key identifies the processing and page settings in file names, or is
+// empty if they are all defaults
+func (s ImageProcessing) Key() string {
+	parts := make([]string, 0, 4)
+	if s.TrimBorders {
+		parts = append(parts, "trim")
+	}
+	if s.MaxWidth > 0 || s.MaxHeight > 0 {
+		parts = append(parts, fmt.Sprintf("%dx%d", s.MaxWidth, s.MaxHeight))
+	}
+	if s.Grayscale {
+		parts = append(parts, "gray")
+	}
+	if s.Spreads != "" {
+		parts = append(parts, s.Spreads)
+	}
+	if s.ReadingDirection != "" {
+		// Orders split and merged pages and is written to the viewer
+		// preferences
+		parts = append(parts, s.ReadingDirection)
+	}
+	switch s.LongStrip {
+	case LongStripOn:
+		parts = append(parts, fmt.Sprintf("strip%g", s.StripPageRatio))
+	case LongStripAuto:
+		parts = append(parts, fmt.Sprintf("autostrip%g", s.StripPageRatio))
+	}
+	switch s.PageLayout {
+	case PageLayoutOriginal:
+		parts = append(parts, "orig")
+	case PageLayoutWidth:
+		parts = append(parts, fmt.Sprintf("w%d", s.PageWidth))
+	}
+	if s.PageDisplay == PageDisplayTwo {
+		parts = append(parts, "two")
+	}
+	return strings.Join(parts, "-")
+}
+
 // AddToWhitelist adds an ID to the whitelist
 func (c *Config) AddToWhitelist(isGroup bool, id int64) {
 	if isGroup {
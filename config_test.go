@@ -0,0 +1,135 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/image/font/gofont/goregular"
+)
+
+func TestReadConfigPermissionsNeedOwnerPassword(t *testing.T) {
+	tests := []struct {
+		name   string
+		config string
+		ok     bool
+	}{
+		{"no password", `{"pdf_no_copy": true}`, false},
+		{"user password only", `{"pdf_password": "pw", "pdf_no_print": true}`, false},
+		{"same owner password", `{"pdf_password": "pw", "pdf_owner_password": "pw", "pdf_no_modify": true}`, false},
+		{"owner password", `{"pdf_owner_password": "owner", "pdf_no_copy": true}`, true},
+		{"both passwords", `{"pdf_password": "pw", "pdf_owner_password": "owner", "pdf_no_print": true}`, true},
+		{"password without flags", `{"pdf_password": "pw"}`, true},
+	}
+
+	for _, tc := range tests {
+		path := filepath.Join(t.TempDir(), "config.json")
+		if err := os.WriteFile(path, []byte(tc.config), 0644); err != nil {
+			t.Fatal(err)
+		}
+		_, err := ReadConfig(path)
+		if tc.ok && err != nil {
+			t.Errorf("%s: %v", tc.name, err)
+		}
+		if !tc.ok && err == nil {
+			t.Errorf("%s: permission flags accepted without a distinct owner password", tc.name)
+		}
+	}
+}
+
+func TestReadConfigGroupProcessingKeepsGlobalFields(t *testing.T) {
+	config := `{
+		"processing": {"trim_borders": true, "max_width": 1600, "spreads": "split"},
+		"group_settings": {
+			"1": {"processing": {"max_width": 1200, "grayscale": true}},
+			"2": {"processing": {"trim_borders": false}},
+			"3": {}
+		}
+	}`
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+	c, err := ReadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		group     int64
+		trim      bool
+		maxWidth  int
+		grayscale bool
+	}{
+		{1, true, 1200, true},
+		{2, false, 1600, false},
+		{3, true, 1600, false},
+		{4, true, 1600, false},
+	}
+	for _, tc := range tests {
+		p := c.ForGroup(tc.group).Processing
+		if p.TrimBorders != tc.trim || p.MaxWidth != tc.maxWidth || p.Grayscale != tc.grayscale {
+			t.Errorf("group %d: trim %v, max width %d, grayscale %v; want %v, %d, %v",
+				tc.group, p.TrimBorders, p.MaxWidth, p.Grayscale, tc.trim, tc.maxWidth, tc.grayscale)
+		}
+		if p.Spreads != SpreadsSplit {
+			t.Errorf("group %d: spreads %q, want the global %q", tc.group, p.Spreads, SpreadsSplit)
+		}
+	}
+}
+
+func TestReadConfigKeepsPagesAsTheyAreByDefault(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(`{}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	c, err := ReadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Long strips and the viewer direction are opt-in, so existing
+	// deployments get the same PDFs and file names as before
+	p := c.Processing
+	if p.LongStrip != LongStripOff || p.ViewerRightToLeft() || p.Key() != "" {
+		t.Errorf("default processing has long strip %q, viewer rtl %v, key %q", p.LongStrip, p.ViewerRightToLeft(), p.Key())
+	}
+}
+
+func TestReadConfigTitlePageNeedsCJKFont(t *testing.T) {
+	dir := t.TempDir()
+	latin := filepath.Join(dir, "Go-Regular.ttf")
+	if err := os.WriteFile(latin, goregular.TTF, 0644); err != nil {
+		t.Fatal(err)
+	}
+	broken := filepath.Join(dir, "broken.ttf")
+	if err := os.WriteFile(broken, []byte("not a font"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		config string
+		ok     bool
+	}{
+		{"title page off", `{"title_page": false}`, true},
+		{"no font", `{"title_page": true}`, false},
+		{"missing font", `{"title_page": true, "title_font": "` + filepath.Join(dir, "none.ttf") + `"}`, false},
+		{"broken font", `{"title_page": true, "title_font": "` + broken + `"}`, false},
+		{"latin font", `{"title_page": true, "title_font": "` + latin + `"}`, false},
+	}
+	for _, tc := range tests {
+		path := filepath.Join(t.TempDir(), "config.json")
+		if err := os.WriteFile(path, []byte(tc.config), 0644); err != nil {
+			t.Fatal(err)
+		}
+		_, err := ReadConfig(path)
+		if tc.ok && err != nil {
+			t.Errorf("%s: %v", tc.name, err)
+		}
+		if !tc.ok && (err == nil || !strings.Contains(err.Error(), "title_font")) {
+			t.Errorf("%s: got error %v, want one about title_font", tc.name, err)
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"testing"
+)
+
+// descrambleSegments runs the descramble segment loop with the given row
+// copy function
+func descrambleSegments(result draw.Image, img image.Image, num int, copySegment func(dst draw.Image, src image.Image, dstY, srcY, segH int)) {
+	height := img.Bounds().Dy()
+	over := height % num
+	move := height / num
+	for i := 0; i < num; i++ {
+		srcY := height - move*(i+1) - over
+		dstY := move * i
+		segH := move
+		if i == 0 {
+			segH += over
+		} else {
+			dstY += over
+		}
+		copySegment(result, img, dstY, srcY, segH)
+	}
+}
+
+// descramblePerPixel is the old descramble: an RGBA result filled pixel by
+// pixel with copyPixels
+func descramblePerPixel(img image.Image, num int) *image.RGBA {
+	result := image.NewRGBA(img.Bounds())
+	descrambleSegments(result, img, num, copyPixels)
+	return result
+}
+
+// descrambleRows is the current descramble
+func descrambleRows(img image.Image, num int) draw.Image {
+	result := newImageLike(img)
+	descrambleSegments(result, img, num, copyRows)
+	return result
+}
+
+// testSources returns a patterned image of each supported source type
+func testSources(width, height int) map[string]image.Image {
+	rect := image.Rect(0, 0, width, height)
+	rgba := image.NewRGBA(rect)
+	nrgba := image.NewNRGBA(rect)
+	gray := image.NewGray(rect)
+	ycbcr := image.NewYCbCr(rect, image.YCbCrSubsampleRatio420)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			rgba.SetRGBA(x, y, color.RGBA{uint8(x), uint8(y), uint8(x ^ y), 255})
+			nrgba.SetNRGBA(x, y, color.NRGBA{uint8(x * 3), uint8(y), uint8(x + y), uint8(128 + y%128)})
+			gray.SetGray(x, y, color.Gray{uint8(x*7 + y)})
+		}
+	}
+	for i := range ycbcr.Y {
+		ycbcr.Y[i] = uint8(i * 13)
+	}
+	for i := range ycbcr.Cb {
+		ycbcr.Cb[i] = uint8(i * 5)
+		ycbcr.Cr[i] = uint8(255 - i*3)
+	}
+	return map[string]image.Image{"RGBA": rgba, "NRGBA": nrgba, "Gray": gray, "YCbCr": ycbcr}
+}
+
+func TestCopyRowsMatchesPerPixel(t *testing.T) {
+	// Heights are not divisible by most segment counts
+	for _, height := range []int{97, 120, 1131} {
+		for name, src := range testSources(61, height) {
+			for _, num := range []int{2, 6, 10, 16, 18} {
+				got := descrambleRows(src, num)
+
+				// Same pixel type: the bytes must match a pixel-by-pixel copy
+				want := newImageLike(src)
+				descrambleSegments(want, src, num, copyPixels)
+				if !bytes.Equal(rgbaPix(got), rgbaPix(want)) {
+					t.Errorf("%s %dpx/%d segments: rows differ from the per-pixel copy of the same type", name, height, num)
+				}
+
+				// And the same colours as the old RGBA result
+				if !bytes.Equal(rgbaPix(got), descramblePerPixel(src, num).Pix) {
+					t.Errorf("%s %dpx/%d segments: rows differ from the old RGBA descramble", name, height, num)
+				}
+			}
+		}
+	}
+}
+
+func TestNewImageLikeKeepsCopyableTypes(t *testing.T) {
+	for name, src := range testSources(4, 4) {
+		got := fmt.Sprintf("%T", newImageLike(src))
+		want := "*image.RGBA"
+		switch name {
+		case "NRGBA":
+			want = "*image.NRGBA"
+		case "Gray":
+			want = "*image.Gray"
+		}
+		if got != want {
+			t.Errorf("newImageLike(%s) = %s, want %s", name, got, want)
+		}
+	}
+}
+
+func benchmarkDescramble(b *testing.B, descramble func(image.Image, int) image.Image) {
+	for name, src := range testSources(900, 1280) {
+		b.Run(name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				descramble(src, 10)
+			}
+		})
+	}
+}
+
+func BenchmarkDescramblePerPixel(b *testing.B) {
+	benchmarkDescramble(b, func(img image.Image, num int) image.Image {
+		return descramblePerPixel(img, num)
+	})
+}
+
+func BenchmarkDescrambleRows(b *testing.B) {
+	benchmarkDescramble(b, func(img image.Image, num int) image.Image {
+		return descrambleRows(img, num)
+	})
+}
@@ -1,7 +1,10 @@
 package main
 
 import (
+	"bytes"
+	"context"
 	"fmt"
+	"image"
 	"os"
 	"path/filepath"
 	"sort"
@@ -11,152 +14,311 @@ import (
 
 // Downloader handles comic image downloads
 type Downloader struct {
-	client *JMClient
-	config *Config
+	client   *JMClient
+	config   *Config
+	pool     *DownloadPool
+	progress *Progress
+	priority int
+	missing  []int
+
+	mu      sync.Mutex
+	created []string // Files written by this downloader
 }
 
 // DownloadedImage represents a downloaded image
 type DownloadedImage struct {
 	Index    int
 	Path     string
-	Data     []byte
+	Size     int64 // File size in bytes
 	Filename string
+	Missing  bool   // Placeholder for an image that failed to download
+	Hash     uint64 // Perceptual hash, set by FilterPages
+}
+
+// imageTask is a single image to download
+type imageTask struct {
+	chapter     *Chapter
+	index       int
+	url         string
+	globalIndex int
+}
+
+// failedTask is an image download that failed
+type failedTask struct {
+	task imageTask
+	err  error
 }
 
 // NewDownloader creates a new downloader
-func NewDownloader(client *JMClient, config *Config) *Downloader {
+func NewDownloader(client *JMClient, config *Config, pool *DownloadPool) *Downloader {
 	return &Downloader{
 		client: client,
 		config: config,
+		pool:   pool,
 	}
 }
 
-// DownloadComic downloads all images for a comic
-func (d *Downloader) DownloadComic(comic *Comic) ([]DownloadedImage, error) {
+// SetProgress sets the tracker that receives download progress
+func (d *Downloader) SetProgress(progress *Progress) {
+	d.progress = progress
+}
+
+// SetPriority sets the priority of this download on the shared pool
+func (d *Downloader) SetPriority(priority int) {
+	d.priority = priority
+}
+
+// DownloadComic downloads all images for a comic.
+// Cancelling ctx stops queued and in-flight downloads.
+func (d *Downloader) DownloadComic(ctx context.Context, comic *Comic) ([]DownloadedImage, error) {
 	// Create download directory
 	downloadDir := filepath.Join(d.config.BaseDir, comic.ID)
 	if err := os.MkdirAll(downloadDir, 0755); err != nil {
 		return nil, fmt.Errorf("failed to create download directory: %w", err)
 	}
 
+	d.progress.SetTotal(comic.Pages)
+
 	// Check if already downloaded
 	existingImages, err := d.checkExistingImages(downloadDir, comic)
 	if err == nil && len(existingImages) > 0 && len(existingImages) >= comic.Pages {
+		for range existingImages {
+			d.progress.AddCached()
+		}
 		return existingImages, nil
 	}
 
-	// Collect all images from all chapters
-	allImages := make([]DownloadedImage, 0, comic.Pages)
+	// Queue images from all chapters on the shared pool so chapters
+	// download concurrently and share workers with other comics
+	job := d.pool.NewJob(d.config.BatchSize, d.priority)
+	defer job.Close()
+
+	allImages := make([]DownloadedImage, comic.Pages)
+	tasks := make([]imageTask, 0, comic.Pages)
 	imageIndex := 0
 
-	for _, chapter := range comic.Chapters {
-		images, err := d.downloadChapter(&chapter, downloadDir, imageIndex)
+	// Keep valid cached images and only download the rest
+	for _, img := range existingImages {
+		if img.Index >= 0 && img.Index < len(allImages) {
+			allImages[img.Index] = img
+			d.progress.AddCached()
+		}
+	}
+
+	for c := range comic.Chapters {
+		chapter := &comic.Chapters[c]
+		for i, imageURL := range chapter.ImageURLs {
+			if allImages[imageIndex+i].Path != "" {
+				continue
+			}
+			tasks = append(tasks, imageTask{
+				chapter:     chapter,
+				index:       i,
+				url:         imageURL,
+				globalIndex: imageIndex + i,
+			})
+		}
+		imageIndex += len(chapter.ImageURLs)
+	}
+
+	// Download everything once, then retry failures at the end so a slow
+	// or flaky image does not hold up the rest of the album
+	failed := d.runTasks(ctx, job, tasks, downloadDir, allImages)
+	for retry := 0; retry < d.config.ImageRetries && len(failed) > 0 && ctx.Err() == nil; retry++ {
+		retryTasks := make([]imageTask, len(failed))
+		for i, f := range failed {
+			retryTasks[i] = f.task
+		}
+		failed = d.runTasks(ctx, job, retryTasks, downloadDir, allImages)
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(failed) > d.config.MaxMissingPages {
+		return nil, fmt.Errorf("%d images failed to download, first error: %v", len(failed), failed[0].err)
+	}
+
+	// Replace the remaining failures with placeholder pages
+	d.missing = make([]int, 0, len(failed))
+	for _, f := range failed {
+		pageNum := f.task.globalIndex + 1
+		imagePath := filepath.Join(downloadDir, fmt.Sprintf("%04d%s", f.task.globalIndex, placeholderExt))
+		size, err := createPlaceholder(imagePath, pageNum)
 		if err != nil {
-			return nil, fmt.Errorf("failed to download chapter %s: %w", chapter.ID, err)
+			return nil, fmt.Errorf("failed to create placeholder for page %d: %w", pageNum, err)
+		}
+		d.addCreated(imagePath)
+		allImages[f.task.globalIndex] = DownloadedImage{
+			Index:    f.task.globalIndex,
+			Path:     imagePath,
+			Size:     size,
+			Filename: filepath.Base(imagePath),
+			Missing:  true,
+		}
+		d.missing = append(d.missing, pageNum)
+	}
+	sort.Ints(d.missing)
+
+	// Filter out empty entries
+	result := make([]DownloadedImage, 0, len(allImages))
+	for _, img := range allImages {
+		if img.Path != "" {
+			result = append(result, img)
 		}
-		allImages = append(allImages, images...)
-		imageIndex += len(images)
 	}
 
 	// Sort images by index
-	sort.Slice(allImages, func(i, j int) bool {
-		return allImages[i].Index < allImages[j].Index
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Index < result[j].Index
 	})
 
-	return allImages, nil
+	return result, nil
 }
 
-// downloadChapter downloads all images for a chapter
-func (d *Downloader) downloadChapter(chapter *Chapter, downloadDir string, startIndex int) ([]DownloadedImage, error) {
-	images := make([]DownloadedImage, len(chapter.ImageURLs))
-	var wg sync.WaitGroup
+// runTasks downloads a set of images on the pool job and stores the
+// results in images. It returns the tasks that failed.
+func (d *Downloader) runTasks(ctx context.Context, job *PoolJob, tasks []imageTask, downloadDir string, images []DownloadedImage) []failedTask {
 	var mu sync.Mutex
-	errors := make([]error, 0)
-
-	// Limit concurrent downloads
-	semaphore := make(chan struct{}, 10)
-
-	for i, imageURL := range chapter.ImageURLs {
-		wg.Add(1)
-		go func(index int, url string) {
-			defer wg.Done()
-			semaphore <- struct{}{}
-			defer func() { <-semaphore }()
-
-			// Get filename from URL or from ImageNames
-			filename := ""
-			if index < len(chapter.ImageNames) {
-				filename = chapter.ImageNames[index]
-			} else {
-				// Extract from URL
-				parts := strings.Split(url, "/")
-				if len(parts) > 0 {
-					filename = parts[len(parts)-1]
-					// Remove query parameters
-					if idx := strings.Index(filename, "?"); idx > 0 {
-						filename = filename[:idx]
-					}
-				}
-			}
+	failed := make([]failedTask, 0)
 
-			// Download image
-			data, err := d.client.DownloadImage(url)
-			if err != nil {
+	for _, task := range tasks {
+		task := task
+		job.Submit(func() {
+			// Skip queued tasks once the download is cancelled
+			if err := ctx.Err(); err != nil {
 				mu.Lock()
-				errors = append(errors, fmt.Errorf("failed to download image %d (%s): %w", index, url, err))
+				failed = append(failed, failedTask{task: task, err: err})
 				mu.Unlock()
 				return
 			}
 
-			// Decode scrambled image
-			decodedData, err := d.client.DecodeScrambledImage(data, chapter, filename)
+			img, err := d.downloadImage(ctx, task.chapter, task.index, task.url, downloadDir, task.globalIndex)
+			mu.Lock()
+			defer mu.Unlock()
 			if err != nil {
-				// Use original data if decoding fails
-				decodedData = data
+				failed = append(failed, failedTask{
+					task: task,
+					err:  fmt.Errorf("chapter %s: %w", task.chapter.ID, err),
+				})
+				return
 			}
+			images[task.globalIndex] = img
+		})
+	}
 
-			// Determine file extension
-			ext := filepath.Ext(filename)
-			if ext == "" {
-				ext = ".jpg"
-			}
+	job.Wait()
 
-			// Save to file
-			globalIndex := startIndex + index
-			imagePath := filepath.Join(downloadDir, fmt.Sprintf("%04d%s", globalIndex, ext))
-			if err := os.WriteFile(imagePath, decodedData, 0644); err != nil {
-				mu.Lock()
-				errors = append(errors, fmt.Errorf("failed to save image %d: %w", index, err))
-				mu.Unlock()
-				return
-			}
+	sort.Slice(failed, func(i, j int) bool {
+		return failed[i].task.globalIndex < failed[j].task.globalIndex
+	})
+	return failed
+}
 
-			mu.Lock()
-			images[index] = DownloadedImage{
-				Index:    globalIndex,
-				Path:     imagePath,
-				Data:     decodedData,
-				Filename: filename,
+// Created returns the files written by this downloader. Pages that were
+// already cached are not included.
+func (d *Downloader) Created() []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]string(nil), d.created...)
+}
+
+// addCreated records a file written by this downloader
+func (d *Downloader) addCreated(path string) {
+	d.mu.Lock()
+	d.created = append(d.created, path)
+	d.mu.Unlock()
+}
+
+// MissingPages returns the 1-based page numbers that were replaced with
+// placeholders in the last DownloadComic call
+func (d *Downloader) MissingPages() []int {
+	return d.missing
+}
+
+// downloadImage downloads, decodes and saves a single chapter image
+func (d *Downloader) downloadImage(ctx context.Context, chapter *Chapter, index int, url string, downloadDir string, globalIndex int) (DownloadedImage, error) {
+	// Get filename from URL or from ImageNames
+	filename := ""
+	if index < len(chapter.ImageNames) {
+		filename = chapter.ImageNames[index]
+	} else {
+		// Extract from URL
+		parts := strings.Split(url, "/")
+		if len(parts) > 0 {
+			filename = parts[len(parts)-1]
+			// Remove query parameters
+			if idx := strings.Index(filename, "?"); idx > 0 {
+				filename = filename[:idx]
 			}
-			mu.Unlock()
-		}(i, imageURL)
+		}
+	}
+
+	// Download image
+	data, err := d.client.DownloadImage(ctx, url)
+	if err != nil {
+		return DownloadedImage{}, fmt.Errorf("failed to download image %d (%s): %w", index, url, err)
 	}
 
-	wg.Wait()
+	// Reserve memory for decoding before holding decoded pixels
+	cost := decodeCost(data)
+	d.pool.Memory().Acquire(cost)
+	defer d.pool.Memory().Release(cost)
 
-	if len(errors) > 0 {
-		return nil, fmt.Errorf("download errors: %v", errors[0])
+	// Reject truncated files and error pages so the image is retried
+	img, format, err := ValidateImageData(data, d.config.MinImageSize)
+	if err != nil {
+		return DownloadedImage{}, fmt.Errorf("invalid image %d (%s): %w", index, url, err)
 	}
 
-	// Filter out empty entries
-	result := make([]DownloadedImage, 0, len(images))
-	for _, img := range images {
-		if img.Path != "" {
-			result = append(result, img)
+	// Count the download once it is known to be good. Failures after this
+	// point are retried, so take it back to keep downloaded <= total.
+	d.progress.AddDownloaded(int64(len(data)))
+	saved := false
+	defer func() {
+		if !saved {
+			d.progress.DropDownloaded(int64(len(data)))
 		}
+	}()
+
+	// Decode scrambled image
+	decodedData, format, err := d.client.descramble(data, img, format, chapter, filename)
+	if err != nil {
+		return DownloadedImage{}, fmt.Errorf("failed to decode image %d (%s): %w", index, url, err)
 	}
 
-	return result, nil
+	// The saved file may be a re-encoded copy, so name it after its content
+	ext := imageExt(format)
+
+	// Save to file
+	imagePath := filepath.Join(downloadDir, fmt.Sprintf("%04d%s", globalIndex, ext))
+	if err := os.WriteFile(imagePath, decodedData, 0644); err != nil {
+		return DownloadedImage{}, fmt.Errorf("failed to save image %d: %w", index, err)
+	}
+	d.addCreated(imagePath)
+	d.progress.AddDecoded()
+	saved = true
+
+	// Drop a placeholder left over from an earlier failed attempt
+	os.Remove(filepath.Join(downloadDir, fmt.Sprintf("%04d%s", globalIndex, placeholderExt)))
+
+	return DownloadedImage{
+		Index:    globalIndex,
+		Path:     imagePath,
+		Size:     int64(len(decodedData)),
+		Filename: filename,
+	}, nil
+}
+
+// decodeCost estimates the memory needed to decode and descramble an image:
+// the encoded data plus a source and destination pixel buffer
+func decodeCost(data []byte) int64 {
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return int64(len(data))
+	}
+	return int64(len(data))*2 + int64(cfg.Width)*int64(cfg.Height)*4*2
 }
 
 // checkExistingImages checks if images are already downloaded
@@ -174,6 +336,11 @@ func (d *Downloader) checkExistingImages(dir string, comic *Comic) ([]Downloaded
 
 		name := entry.Name()
 		ext := strings.ToLower(filepath.Ext(name))
+
+		// Placeholders are never reused, the page is retried next time
+		if strings.HasSuffix(name, placeholderExt) {
+			continue
+		}
 		
 		// Only include image files
 		if ext != ".jpg" && ext != ".jpeg" && ext != ".png" && ext != ".webp" && ext != ".gif" {
@@ -181,11 +348,17 @@ func (d *Downloader) checkExistingImages(dir string, comic *Comic) ([]Downloaded
 		}
 
 		imagePath := filepath.Join(dir, name)
-		data, err := os.ReadFile(imagePath)
+		info, err := entry.Info()
 		if err != nil {
 			continue
 		}
 
+		// Drop corrupt cached files so they are downloaded again
+		if err := ValidateImageFile(imagePath, d.config.MinImageSize); err != nil {
+			os.Remove(imagePath)
+			continue
+		}
+
 		// Extract index from filename
 		indexStr := strings.TrimSuffix(name, ext)
 		index := 0
@@ -194,7 +367,7 @@ func (d *Downloader) checkExistingImages(dir string, comic *Comic) ([]Downloaded
 		images = append(images, DownloadedImage{
 			Index:    index,
 			Path:     imagePath,
-			Data:     data,
+			Size:     info.Size(),
 			Filename: name,
 		})
 	}
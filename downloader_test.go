@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDownloaderCreatedExcludesCachedPages(t *testing.T) {
+	const pages = 3
+	page := testPageData(t, 100, 120, "png")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(page)
+	}))
+	defer server.Close()
+
+	config := DefaultConfig()
+	config.BaseDir = t.TempDir()
+	comic := &Comic{ID: "created", Pages: pages, Chapters: []Chapter{{ID: "1", ScrambleID: "220980"}}}
+	for i := 0; i < pages; i++ {
+		comic.Chapters[0].ImageURLs = append(comic.Chapters[0].ImageURLs, fmt.Sprintf("%s/%05d.png", server.URL, i+1))
+	}
+
+	// The first page is left over from an earlier job
+	albumDir := filepath.Join(config.BaseDir, comic.ID)
+	if err := os.MkdirAll(albumDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	cached := filepath.Join(albumDir, "0000.png")
+	if err := os.WriteFile(cached, page, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	pool := NewDownloadPool(2, 0)
+	defer pool.Close()
+	d := NewDownloader(NewJMClient(config), config, pool)
+	images, err := d.DownloadComic(context.Background(), comic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(images) != pages {
+		t.Fatalf("got %d pages, want %d", len(images), pages)
+	}
+
+	created := d.Created()
+	if len(created) != pages-1 {
+		t.Fatalf("created %v, want the %d downloaded pages", created, pages-1)
+	}
+	for _, path := range created {
+		if path == cached {
+			t.Errorf("cached page %s reported as created", path)
+		}
+	}
+}
+
+func TestPDFGeneratorCreatedExcludesCachedPDFs(t *testing.T) {
+	dir := t.TempDir()
+	comic := &Comic{ID: "created"}
+	albumDir := filepath.Join(dir, comic.ID)
+	if err := os.MkdirAll(albumDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	images := writeTestAlbum(t, albumDir, 2, 60, 80)
+
+	config := DefaultConfig()
+	config.BaseDir = dir
+	first := NewPDFGenerator(config)
+	files, err := first.CreatePDF(context.Background(), comic, images)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := first.Created(); len(got) != 1 || got[0] != files[0] {
+		t.Errorf("first build created %v, want %v", got, files)
+	}
+
+	second := NewPDFGenerator(config)
+	if _, err := second.CreatePDF(context.Background(), comic, images); err != nil {
+		t.Fatal(err)
+	}
+	if got := second.Created(); len(got) != 0 {
+		t.Errorf("reusing the cached PDF reported %v as created", got)
+	}
+}
@@ -5,17 +5,15 @@ go 1.24.0
 require (
 	github.com/DaikonSushi/bot-platform v0.0.2
 	github.com/pdfcpu/pdfcpu v0.9.1
-	github.com/signintech/gopdf v0.28.0
+	golang.org/x/image v0.21.0
 )
 
 require (
 	github.com/hhrutter/lzw v1.0.0 // indirect
 	github.com/hhrutter/tiff v1.0.1 // indirect
 	github.com/mattn/go-runewidth v0.0.16 // indirect
-	github.com/phpdave11/gofpdi v1.0.14-0.20211212211723-1f10f9844311 // indirect
 	github.com/pkg/errors v0.9.1 // indirect
 	github.com/rivo/uniseg v0.4.7 // indirect
-	golang.org/x/image v0.21.0 // indirect
 	golang.org/x/net v0.47.0 // indirect
 	golang.org/x/sys v0.38.0 // indirect
 	golang.org/x/text v0.31.0 // indirect
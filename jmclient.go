@@ -2,25 +2,26 @@ package main
 
 import (
 	"bytes"
-	"crypto/md5"
+	"context"
 	"crypto/tls"
-	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"image"
+	"image/draw"
 	"image/jpeg"
-	_ "image/png"
+	"image/png"
 	"io"
 	"math/rand"
 	"net/http"
 	"net/url"
-	"path/filepath"
 	"regexp"
 	"sort"
 	"strconv"
 	"strings"
 	"sync"
 	"time"
+
+	_ "golang.org/x/image/webp"
 )
 
 // JMClient handles JM API requests
@@ -32,6 +33,7 @@ type JMClient struct {
 	imgDomain    string
 	mu           sync.RWMutex
 	maxPageCache map[string]*maxPageCacheEntry
+	limiter      *RateLimiter // Shared bandwidth cap for image downloads
 }
 
 // maxPageCacheEntry stores cached max page info
@@ -47,6 +49,7 @@ type Comic struct {
 	Author      string    `json:"author"`
 	Description string    `json:"description"`
 	Tags        []string  `json:"tags"`
+	URL         string    `json:"url"`
 	Pages       int       `json:"pages"`
 	Chapters    []Chapter `json:"chapters"`
 }
@@ -113,6 +116,7 @@ func NewJMClient(config *Config) *JMClient {
 		},
 		domains:      config.JMDomains,
 		maxPageCache: make(map[string]*maxPageCacheEntry),
+		limiter:      NewRateLimiter(int64(config.BandwidthLimitKB) * 1024),
 	}
 
 	// Use default domains if none configured
@@ -184,7 +188,8 @@ func (c *JMClient) fetchComicDetail(baseURL, comicID string) (*Comic, error) {
 
 	// Parse comic info from HTML
 	comic := &Comic{
-		ID: comicID,
+		ID:  comicID,
+		URL: albumURL,
 	}
 
 	// Extract title - pattern: id="book-name">xxx<
@@ -247,11 +252,12 @@ func (c *JMClient) fetchComicDetail(baseURL, comicID string) (*Comic, error) {
 		albumScrambleID = matches[1]
 	}
 
-	// Extract chapters (photo IDs) - pattern: data-album="xxx"
-	episodeRe := regexp.MustCompile(`data-album="(\d+)"[^>]*>[\s\S]*?第(\d+)[话話]`)
+	// Extract chapters (photo IDs) - pattern: data-album="xxx" ... 第N话 title
+	episodeRe := regexp.MustCompile(`data-album="(\d+)"[^>]*>[\s\S]*?第(\d+)[话話]([^<]*)`)
 	episodeMatches := episodeRe.FindAllStringSubmatch(html, -1)
 
 	photoIDs := make([]string, 0)
+	chapterTitles := make(map[string]string)
 	
 	if len(episodeMatches) > 0 {
 		// Multi-chapter comic
@@ -262,12 +268,14 @@ func (c *JMClient) fetchComicDetail(baseURL, comicID string) (*Comic, error) {
 				if !seen[pid] {
 					seen[pid] = true
 					photoIDs = append(photoIDs, pid)
+					chapterTitles[pid] = strings.TrimSpace(fmt.Sprintf("第%s话 %s", match[2], strings.TrimSpace(match[3])))
 				}
 			}
 		}
 	} else {
 		// Single chapter comic - use album ID
 		photoIDs = append(photoIDs, comicID)
+		chapterTitles[comicID] = comic.Title
 	}
 
 	// Sort photo IDs
@@ -284,7 +292,10 @@ func (c *JMClient) fetchComicDetail(baseURL, comicID string) (*Comic, error) {
 		if err != nil {
 			continue // Skip failed chapters
 		}
-		chapter.Title = fmt.Sprintf("Chapter %d", i+1)
+		chapter.Title = chapterTitles[photoID]
+		if chapter.Title == "" {
+			chapter.Title = fmt.Sprintf("Chapter %d", i+1)
+		}
 		chapters = append(chapters, *chapter)
 	}
 
@@ -744,8 +755,8 @@ func (c *JMClient) GetCurrentDomain() string {
 }
 
 // DownloadImage downloads an image from URL
-func (c *JMClient) DownloadImage(imageURL string) ([]byte, error) {
-	req, err := http.NewRequest("GET", imageURL, nil)
+func (c *JMClient) DownloadImage(ctx context.Context, imageURL string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", imageURL, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -762,7 +773,7 @@ func (c *JMClient) DownloadImage(imageURL string) ([]byte, error) {
 		return nil, fmt.Errorf("image download returned status %d for URL %s", resp.StatusCode, imageURL)
 	}
 
-	data, err := io.ReadAll(resp.Body)
+	data, err := io.ReadAll(c.limiter.Reader(ctx, resp.Body))
 	if err != nil {
 		return nil, err
 	}
@@ -771,40 +782,17 @@ func (c *JMClient) DownloadImage(imageURL string) ([]byte, error) {
 }
 
 // GetScrambleNum calculates the scramble number for image decoding
-// This is the core algorithm from JMComic-Crawler-Python
+// This is the core algorithm from JMComic-Crawler-Python, driven by the
+// configured scramble rules
 func (c *JMClient) GetScrambleNum(scrambleID string, photoID string, filename string) int {
 	scrambleIDInt, _ := strconv.Atoi(scrambleID)
 	aid, _ := strconv.Atoi(photoID)
 
 	if aid < scrambleIDInt {
 		return 0
-	} else if aid < SCRAMBLE_268850 {
-		return 10
-	} else {
-		// New algorithm after SCRAMBLE_421926
-		x := 10
-		if aid >= SCRAMBLE_421926 {
-			x = 8
-		}
-		
-		// Remove file extension from filename (important!)
-		// Python: of_file_name(url, trim_suffix=True)
-		ext := filepath.Ext(filename)
-		filenameWithoutExt := strings.TrimSuffix(filename, ext)
-		
-		// MD5 hash based calculation
-		s := fmt.Sprintf("%d%s", aid, filenameWithoutExt)
-		hash := md5.Sum([]byte(s))
-		hashHex := hex.EncodeToString(hash[:])
-		
-		// Get last character's ASCII value
-		lastChar := hashHex[len(hashHex)-1]
-		num := int(lastChar)
-		num = num % x
-		num = num*2 + 2
-		
-		return num
 	}
+
+	return scrambleSegments(c.config.ScrambleRules, aid, filename)
 }
 
 // DecodeScrambledImage decodes JM's scrambled images
@@ -813,23 +801,36 @@ func (c *JMClient) DecodeScrambledImage(data []byte, chapter *Chapter, filename
 	// Parse the image
 	img, format, err := image.Decode(bytes.NewReader(data))
 	if err != nil {
-		// If decode fails, return original data (might not be scrambled)
-		return data, nil
+		return nil, fmt.Errorf("failed to decode image: %w", err)
 	}
 
+	decoded, _, err := c.descramble(data, img, format, chapter, filename)
+	return decoded, err
+}
+
+// descramble restores an already decoded image and returns the encoded
+// result and its format. Each page is encoded at most once: unscrambled
+// pages keep their original data unless JPEG compression is configured.
+func (c *JMClient) descramble(data []byte, img image.Image, format string, chapter *Chapter, filename string) ([]byte, string, error) {
 	bounds := img.Bounds()
-	width := bounds.Dx()
 	height := bounds.Dy()
 
 	// Calculate scramble number
 	scrambleNum := c.GetScrambleNum(chapter.ScrambleID, chapter.ID, filename)
 	if scrambleNum == 0 {
-		// No scrambling needed
-		return data, nil
+		// No scrambling needed, only compress if configured
+		if format == "jpeg" && c.config.ImageQuality > 0 && c.config.ImageQuality < 100 {
+			return encodeImage(img, format, c.config.JPEGQuality())
+		}
+		// PDF cannot embed WebP, so convert it once here
+		if format == "webp" {
+			return encodeImage(img, format, c.config.JPEGQuality())
+		}
+		return data, format, nil
 	}
 
 	// Create new image for decoded result
-	result := image.NewRGBA(bounds)
+	result := newImageLike(img)
 
 	// Algorithm from Python JMComic library:
 	// over = height % num (remainder)
@@ -856,26 +857,110 @@ func (c *JMClient) DecodeScrambledImage(data []byte, chapter *Chapter, filename
 		}
 
 		// Copy segment from source to destination
-		for y := 0; y < segH; y++ {
-			for x := 0; x < width; x++ {
-				result.Set(x, dstY+y, img.At(x, srcY+y))
-			}
-		}
+		copyRows(result, img, dstY, srcY, segH)
 	}
 
-	// Encode result
+	// Encode result once, keeping the source format
+	return encodeImage(result, format, c.config.JPEGQuality())
+}
+
+// encodeImage encodes an image in a format matching its source format.
+// Lossless sources (PNG, GIF) are stored as PNG, everything else (JPEG,
+// WebP) as JPEG.
+// It returns the encoded data and the format used.
+func encodeImage(img image.Image, format string, quality int) ([]byte, string, error) {
 	var buf bytes.Buffer
-	if format == "jpeg" || format == "jpg" {
-		err = jpeg.Encode(&buf, result, &jpeg.Options{Quality: 95})
-	} else {
-		// Default to JPEG
-		err = jpeg.Encode(&buf, result, &jpeg.Options{Quality: 95})
+	switch format {
+	case "png", "gif":
+		if err := png.Encode(&buf, img); err != nil {
+			return nil, "", fmt.Errorf("failed to encode image: %w", err)
+		}
+		return buf.Bytes(), "png", nil
+	default:
+		if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality}); err != nil {
+			return nil, "", fmt.Errorf("failed to encode image: %w", err)
+		}
+		return buf.Bytes(), "jpeg", nil
 	}
-	if err != nil {
-		return data, nil
+}
+
+// imageExt returns the file extension for an image format
+func imageExt(format string) string {
+	switch format {
+	case "jpeg":
+		return ".jpg"
+	case "":
+		return ".jpg"
+	default:
+		return "." + format
+	}
+}
+
+// newImageLike creates an empty image for the descrambled copy of img.
+// Images with a pixel layout copyRows can copy directly keep their type,
+// everything else is converted to RGBA.
+func newImageLike(img image.Image) draw.Image {
+	bounds := img.Bounds()
+	switch img.(type) {
+	case *image.Gray:
+		return image.NewGray(bounds)
+	case *image.NRGBA:
+		return image.NewNRGBA(bounds)
+	default:
+		return image.NewRGBA(bounds)
+	}
+}
+
+// copyRows copies segH full-width rows starting at srcY in src to dstY in
+// dst. Rows are copied straight between pixel buffers when both images
+// share a layout, and with draw.Draw on the segment otherwise.
+func copyRows(dst draw.Image, src image.Image, dstY, srcY, segH int) {
+	if segH <= 0 {
+		return
+	}
+	bounds := src.Bounds()
+
+	var dstPix, srcPix []byte
+	var dstStride, srcStride, dstBase, srcBase, rowBytes int
+	switch d := dst.(type) {
+	case *image.RGBA:
+		if s, ok := src.(*image.RGBA); ok {
+			dstPix, dstStride, dstBase = d.Pix, d.Stride, d.PixOffset(bounds.Min.X, bounds.Min.Y)
+			srcPix, srcStride, srcBase = s.Pix, s.Stride, s.PixOffset(bounds.Min.X, bounds.Min.Y)
+			rowBytes = bounds.Dx() * 4
+		}
+	case *image.NRGBA:
+		if s, ok := src.(*image.NRGBA); ok {
+			dstPix, dstStride, dstBase = d.Pix, d.Stride, d.PixOffset(bounds.Min.X, bounds.Min.Y)
+			srcPix, srcStride, srcBase = s.Pix, s.Stride, s.PixOffset(bounds.Min.X, bounds.Min.Y)
+			rowBytes = bounds.Dx() * 4
+		}
+	case *image.Gray:
+		if s, ok := src.(*image.Gray); ok {
+			dstPix, dstStride, dstBase = d.Pix, d.Stride, d.PixOffset(bounds.Min.X, bounds.Min.Y)
+			srcPix, srcStride, srcBase = s.Pix, s.Stride, s.PixOffset(bounds.Min.X, bounds.Min.Y)
+			rowBytes = bounds.Dx()
+		}
 	}
 
-	return buf.Bytes(), nil
+	if dstPix == nil {
+		dstRect := image.Rect(bounds.Min.X, bounds.Min.Y+dstY, bounds.Max.X, bounds.Min.Y+dstY+segH)
+		draw.Draw(dst, dstRect, src, image.Pt(bounds.Min.X, bounds.Min.Y+srcY), draw.Src)
+		return
+	}
+
+	// Contiguous rows can be moved as one block
+	d := dstBase + dstY*dstStride
+	s := srcBase + srcY*srcStride
+	if dstStride == srcStride && rowBytes == srcStride {
+		copy(dstPix[d:d+segH*dstStride], srcPix[s:s+segH*srcStride])
+		return
+	}
+	for y := 0; y < segH; y++ {
+		copy(dstPix[d:d+rowBytes], srcPix[s:s+rowBytes])
+		d += dstStride
+		s += srcStride
+	}
 }
 
 // Helper function to parse JSON
@@ -0,0 +1,368 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/DaikonSushi/bot-platform/pkg/pluginsdk"
+)
+
+// Job states
+const (
+	JobQueued  = "queued"
+	JobRunning = "running"
+)
+
+// Job priorities, higher runs first
+const (
+	PriorityNormal = 0
+	PriorityAdmin  = 2
+)
+
+// DownloadJob is one album download shared by everyone who requested it
+type DownloadJob struct {
+	AlbumID    string
+	Title      string
+	State      string
+	CreatedAt  time.Time
+	StartedAt  time.Time
+	Progress   *Progress
+	Priority   int // Highest priority among requesters
+	Pages      int // 0 until the album details are known
+	comic      *Comic
+	requesters []*pluginsdk.Message
+	options    map[*pluginsdk.Message]DownloadOptions
+	ctx        context.Context
+	cancel     context.CancelFunc
+	cancelled  bool
+}
+
+// Job manager errors
+var (
+	ErrJobNotFound  = errors.New("job not found")
+	ErrNotRequester = errors.New("not a requester of this job")
+)
+
+// JobManager deduplicates downloads by album and limits how many run at once
+type JobManager struct {
+	mu         sync.Mutex
+	jobs       map[string]*DownloadJob
+	queue      []*DownloadJob
+	running    int
+	maxRunning int
+	smallPages int // Albums with at most this many pages get a priority boost
+	run        func(job *DownloadJob)
+}
+
+// NewJobManager creates a job manager that executes jobs with run
+func NewJobManager(maxRunning int, smallPages int, run func(job *DownloadJob)) *JobManager {
+	if maxRunning <= 0 {
+		maxRunning = 1
+	}
+	return &JobManager{
+		jobs:       make(map[string]*DownloadJob),
+		maxRunning: maxRunning,
+		smallPages: smallPages,
+		run:        run,
+	}
+}
+
+// Submit adds a request for an album with the requester's options and
+// priority. If a job for the album already exists the requester is
+// subscribed to it and isNew is false. position is the job's place in the
+// queue, or 0 if it is already running.
+func (m *JobManager) Submit(albumID string, msg *pluginsdk.Message, opts DownloadOptions, priority int) (job *DownloadJob, position int, isNew bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	job, ok := m.jobs[albumID]
+	if ok {
+		job.addRequester(msg, opts)
+		if priority > job.Priority {
+			job.Priority = priority
+			m.sortQueue()
+		}
+	} else {
+		ctx, cancel := context.WithCancel(context.Background())
+		job = &DownloadJob{
+			AlbumID:   albumID,
+			State:     JobQueued,
+			CreatedAt: time.Now(),
+			Progress:  NewProgress(),
+			Priority:  priority,
+			options:   make(map[*pluginsdk.Message]DownloadOptions),
+			ctx:       ctx,
+			cancel:    cancel,
+		}
+		job.addRequester(msg, opts)
+		m.jobs[albumID] = job
+		m.queue = append(m.queue, job)
+		m.sortQueue()
+		m.schedule()
+	}
+
+	for i, queued := range m.queue {
+		if queued == job {
+			return job, i + 1, !ok
+		}
+	}
+	return job, 0, !ok
+}
+
+// priority returns a job's effective priority.
+// Must be called with m.mu held.
+func (m *JobManager) priority(job *DownloadJob) int {
+	priority := job.Priority
+	if job.Pages > 0 && job.Pages <= m.smallPages {
+		priority++
+	}
+	return priority
+}
+
+// sortQueue orders queued jobs by priority, keeping FIFO order within a priority.
+// Must be called with m.mu held.
+func (m *JobManager) sortQueue() {
+	sort.SliceStable(m.queue, func(i, j int) bool {
+		return m.priority(m.queue[i]) > m.priority(m.queue[j])
+	})
+}
+
+// Priority returns the effective priority of a job
+func (m *JobManager) Priority(job *DownloadJob) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.priority(job)
+}
+
+// schedule starts queued jobs while there are free slots.
+// Must be called with m.mu held.
+func (m *JobManager) schedule() {
+	for m.running < m.maxRunning && len(m.queue) > 0 {
+		job := m.queue[0]
+		m.queue = m.queue[1:]
+		job.State = JobRunning
+		job.StartedAt = time.Now()
+		m.running++
+
+		go func() {
+			m.run(job)
+			job.cancel()
+
+			m.mu.Lock()
+			m.running--
+			if m.jobs[job.AlbumID] == job {
+				delete(m.jobs, job.AlbumID)
+			}
+			m.schedule()
+			m.mu.Unlock()
+		}()
+	}
+}
+
+// Requesters returns a snapshot of everyone subscribed to the job
+func (m *JobManager) Requesters(job *DownloadJob) []*pluginsdk.Message {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]*pluginsdk.Message{}, job.requesters...)
+}
+
+// Options returns the options a requester gave with their request
+func (m *JobManager) Options(job *DownloadJob, msg *pluginsdk.Message) DownloadOptions {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return job.options[msg]
+}
+
+// Complete records that served requesters have been delivered to.
+// It returns requesters that subscribed after the snapshot was taken; when
+// there are none the job is removed so new requests start a fresh job.
+func (m *JobManager) Complete(job *DownloadJob, served map[*pluginsdk.Message]bool) []*pluginsdk.Message {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	pending := make([]*pluginsdk.Message, 0)
+	for _, r := range job.requesters {
+		if !served[r] {
+			pending = append(pending, r)
+		}
+	}
+	if len(pending) > 0 {
+		return pending
+	}
+	if m.jobs[job.AlbumID] == job {
+		delete(m.jobs, job.AlbumID)
+	}
+	return nil
+}
+
+// Cancel cancels an album's job on behalf of msg's sender.
+// Admins cancel the whole job. Other requesters are unsubscribed, and the
+// job is only cancelled once nobody else is waiting for it; cancelled
+// reports which of the two happened.
+func (m *JobManager) Cancel(albumID string, msg *pluginsdk.Message, isAdmin bool) (job DownloadJob, cancelled bool, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	j, ok := m.jobs[albumID]
+	if !ok || j.cancelled {
+		return DownloadJob{}, false, ErrJobNotFound
+	}
+
+	idx := j.requesterIndex(msg)
+	if idx < 0 && !isAdmin {
+		return DownloadJob{}, false, ErrNotRequester
+	}
+
+	if !isAdmin && len(j.requesters) > 1 {
+		j.requesters = append(j.requesters[:idx], j.requesters[idx+1:]...)
+		return j.snapshot(), false, nil
+	}
+
+	// The caller notifies everyone subscribed so far; anyone subscribing
+	// while the job winds down is told by the job itself
+	job = j.snapshot()
+	j.requesters = nil
+	j.cancelled = true
+	if j.State == JobQueued {
+		// Nobody is working on it yet, just drop it from the queue
+		for i, queued := range m.queue {
+			if queued == j {
+				m.queue = append(m.queue[:i], m.queue[i+1:]...)
+				break
+			}
+		}
+		delete(m.jobs, albumID)
+	} else {
+		// The running job notices through its context and winds down
+		j.cancel()
+	}
+
+	return job, true, nil
+}
+
+// SetComic records the album details once they are known.
+// Queued jobs are reordered since small albums get a priority boost.
+func (m *JobManager) SetComic(job *DownloadJob, comic *Comic) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	job.comic = comic
+	job.Title = comic.Title
+	job.Pages = comic.Pages
+	m.sortQueue()
+}
+
+// Comic returns the album details if they were already fetched
+func (m *JobManager) Comic(job *DownloadJob) *Comic {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return job.comic
+}
+
+// Find returns a snapshot of the job for an album
+func (m *JobManager) Find(albumID string) (DownloadJob, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	job, ok := m.jobs[albumID]
+	if !ok {
+		return DownloadJob{}, false
+	}
+	return job.snapshot(), true
+}
+
+// List returns running jobs followed by queued jobs in queue order
+func (m *JobManager) List() []DownloadJob {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	running := make([]DownloadJob, 0)
+	for _, job := range m.jobs {
+		if job.State == JobRunning {
+			running = append(running, job.snapshot())
+		}
+	}
+	// Keep running jobs in start order
+	sort.Slice(running, func(i, j int) bool {
+		return running[i].StartedAt.Before(running[j].StartedAt)
+	})
+
+	list := running
+	for _, job := range m.queue {
+		list = append(list, job.snapshot())
+	}
+	return list
+}
+
+// snapshot copies the job so it can be read without holding the lock
+func (j *DownloadJob) snapshot() DownloadJob {
+	cp := *j
+	cp.requesters = append([]*pluginsdk.Message{}, j.requesters...)
+	return cp
+}
+
+// Context returns the job's context, which is cancelled by Cancel
+func (j *DownloadJob) Context() context.Context {
+	return j.ctx
+}
+
+// Requesters returns the messages of everyone waiting for the job
+func (j DownloadJob) Requesters() []*pluginsdk.Message {
+	return j.requesters
+}
+
+// Cancelled reports whether a running job was cancelled
+func (j *DownloadJob) Cancelled() bool {
+	return j.ctx.Err() != nil
+}
+
+// addRequester subscribes a message sender unless the same chat already is
+func (j *DownloadJob) addRequester(msg *pluginsdk.Message, opts DownloadOptions) {
+	if j.requesterIndex(msg) >= 0 {
+		return
+	}
+	j.requesters = append(j.requesters, msg)
+	j.options[msg] = opts
+}
+
+// requesterIndex finds the requester from the same user and chat as msg
+func (j *DownloadJob) requesterIndex(msg *pluginsdk.Message) int {
+	for i, r := range j.requesters {
+		if r.Type == msg.Type && r.GroupID == msg.GroupID && r.UserID == msg.UserID {
+			return i
+		}
+	}
+	return -1
+}
+
+// RequesterNames returns display names of everyone waiting for the job
+func (j *DownloadJob) RequesterNames() string {
+	names := make([]string, 0, len(j.requesters))
+	for _, r := range j.requesters {
+		names = append(names, requesterName(r))
+	}
+	return strings.Join(names, ", ")
+}
+
+// requesterName formats a message sender for display
+func requesterName(msg *pluginsdk.Message) string {
+	name := ""
+	if msg.Sender != nil {
+		name = msg.Sender.Card
+		if name == "" {
+			name = msg.Sender.Nickname
+		}
+	}
+	if name == "" {
+		name = fmt.Sprintf("%d", msg.UserID)
+	}
+	if msg.Type == "group" {
+		return fmt.Sprintf("%s(群%d)", name, msg.GroupID)
+	}
+	return name
+}
@@ -5,9 +5,11 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"path/filepath"
 	"regexp"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/DaikonSushi/bot-platform/pkg/pluginsdk"
 )
@@ -17,6 +19,9 @@ type ShowMeJMPlugin struct {
 	bot    *pluginsdk.BotClient
 	config *Config
 	client *JMClient
+	pool   *DownloadPool
+	jobs   *JobManager
+	ads    *AdLibrary
 }
 
 // Info returns plugin metadata
@@ -26,7 +31,7 @@ func (p *ShowMeJMPlugin) Info() pluginsdk.PluginInfo {
 		Version:           "3.1.0",
 		Description:       "JM comic download and search plugin with full PDF support",
 		Author:            "hovanzhang",
-		Commands:          []string{"jm", "查jm", "随机jm", "jm更新域名", "jm清空域名"},
+		Commands:          []string{"jm", "查jm", "随机jm", "jm更新域名", "jm清空域名", "jm队列", "jm进度", "jm取消", "jm广告"},
 		HandleAllMessages: true, // Need to handle auto-find JM numbers
 	}
 }
@@ -46,12 +51,29 @@ func (p *ShowMeJMPlugin) OnStart(bot *pluginsdk.BotClient) error {
 	// Initialize JM client
 	p.client = NewJMClient(config)
 
+	// Initialize shared download worker pool
+	p.pool = NewDownloadPool(config.ConcurrentDownload, int64(config.MemoryBudgetMB)<<20)
+
+	// Load known ad pages
+	ads, err := LoadAdLibrary(config.AdLibrary)
+	if err != nil {
+		bot.Log("error", fmt.Sprintf("Failed to load ad library: %v", err))
+		return err
+	}
+	p.ads = ads
+
+	// Initialize download job queue
+	p.jobs = NewJobManager(config.MaxConcurrentJobs, config.SmallAlbumPages, p.runJob)
+
 	bot.Log("info", "ShowMeJM plugin v3.1.0 started successfully")
 	return nil
 }
 
 // OnStop is called when the plugin stops
 func (p *ShowMeJMPlugin) OnStop() error {
+	if p.pool != nil {
+		p.pool.Close()
+	}
 	if p.client != nil {
 		p.client.Close()
 	}
@@ -86,7 +108,7 @@ func (p *ShowMeJMPlugin) OnMessage(ctx context.Context, bot *pluginsdk.BotClient
 		if len(numbers) > 0 {
 			concatenated := strings.Join(numbers, "")
 			if len(concatenated) >= 6 && len(concatenated) <= 7 {
-				go p.downloadComic(ctx, bot, msg, concatenated)
+				go p.downloadComic(ctx, bot, msg, concatenated, nil)
 				return p.config.PreventDefault
 			}
 		}
@@ -129,9 +151,21 @@ func (p *ShowMeJMPlugin) OnCommand(ctx context.Context, bot *pluginsdk.BotClient
 		case "更新域名":
 			go p.updateDomains(ctx, bot, msg)
 			return true
+		case "queue", "队列":
+			p.showQueue(bot, msg)
+			return true
+		case "progress", "进度":
+			p.showProgress(bot, msg, args[1:])
+			return true
+		case "cancel", "取消":
+			p.cancelJob(bot, msg, args[1:])
+			return true
+		case "ad", "广告":
+			go p.addAdPage(bot, msg, args[1:])
+			return true
 		default:
-			// Treat as comic ID
-			go p.downloadComic(ctx, bot, msg, args[0])
+			// Treat as comic ID, followed by download options
+			go p.downloadComic(ctx, bot, msg, args[0], args[1:])
 			return true
 		}
 
@@ -150,6 +184,22 @@ func (p *ShowMeJMPlugin) OnCommand(ctx context.Context, bot *pluginsdk.BotClient
 	case cmd == "jm清空域名":
 		p.clearDomains(ctx, bot, msg)
 		return true
+
+	case cmd == "jm队列":
+		p.showQueue(bot, msg)
+		return true
+
+	case cmd == "jm进度":
+		p.showProgress(bot, msg, args)
+		return true
+
+	case cmd == "jm取消":
+		p.cancelJob(bot, msg, args)
+		return true
+
+	case cmd == "jm广告":
+		go p.addAdPage(bot, msg, args)
+		return true
 	}
 
 	return false
@@ -176,8 +226,10 @@ func (p *ShowMeJMPlugin) showHelp(bot *pluginsdk.BotClient, msg *pluginsdk.Messa
 例: 查jm 鸣潮,+无修正 2
 
 2.📥 下载指定id的本子:
-格式: jm [jm号]
+格式: jm [jm号] [选项(可选)]
 例: jm 114514
+选项: 长条 - 按条漫拼接后重新分页，分页 - 保持原始分页
+原图/a4/等宽 - 页面尺寸，双页/单页 - 阅读器显示方式，右翻/左翻 - 阅读方向
 
 3.🎲 下载随机本子:
 格式: 随机jm [关键词(可选)]
@@ -185,7 +237,16 @@ func (p *ShowMeJMPlugin) showHelp(bot *pluginsdk.BotClient, msg *pluginsdk.Messa
 4.🌐 域名管理:
 - jm check / jm更新域名 - 自动检测可用域名
 - jm domain <域名> - 手动设置域名
-- jm clear / jm清空域名 - 清除自定义域名`
+- jm clear / jm清空域名 - 清除自定义域名
+
+5.📋 下载队列:
+格式: jm队列
+查看进度: jm进度 [jm号(可选)]
+取消下载: jm取消 [jm号]
+
+6.🧹 标记广告页（管理员）:
+格式: jm广告 [jm号] [页码]
+之后所有本子中相同的页面都会被移除`
 
 	if p.config.PDFPassword != "" {
 		helpText += "\n\n🔐 PDF密码：" + p.config.PDFPassword
@@ -194,45 +255,410 @@ func (p *ShowMeJMPlugin) showHelp(bot *pluginsdk.BotClient, msg *pluginsdk.Messa
 	bot.Reply(msg, pluginsdk.Text(helpText))
 }
 
-// downloadComic downloads a comic by ID
-func (p *ShowMeJMPlugin) downloadComic(ctx context.Context, bot *pluginsdk.BotClient, msg *pluginsdk.Message, comicID string) {
+// downloadComic queues a comic download by ID with optional option words
+func (p *ShowMeJMPlugin) downloadComic(ctx context.Context, bot *pluginsdk.BotClient, msg *pluginsdk.Message, comicID string, args []string) {
 	// Clean comic ID
 	comicID = strings.TrimSpace(comicID)
 	comicID = strings.TrimPrefix(strings.ToUpper(comicID), "JM")
 
+	opts, unknown := ParseDownloadOptions(args)
+	if len(unknown) > 0 {
+		bot.Reply(msg, pluginsdk.Text(fmt.Sprintf("⚠️ 忽略未知选项: %s", strings.Join(unknown, " "))))
+	}
 
-	// Get comic details
-	comic, err := p.client.GetComicDetail(comicID)
-	if err != nil {
-		bot.Reply(msg, pluginsdk.Text(fmt.Sprintf("❌ 获取漫画信息失败: %v", err)))
+	priority := PriorityNormal
+	if p.config.IsAdmin(msg.UserID) {
+		priority = PriorityAdmin
+	}
+
+	job, position, isNew := p.jobs.Submit(comicID, msg, opts, priority)
+	if !isNew {
+		bot.Reply(msg, pluginsdk.Text(fmt.Sprintf("⏳ JM%s 已在下载中，完成后会一并发送给你", comicID)))
+		return
+	}
+	if position > 0 {
+		bot.Reply(msg, pluginsdk.Text(fmt.Sprintf("⏳ JM%s 已加入下载队列（第 %d 位），发送 jm队列 查看进度", comicID, position)))
+
+		// Fetch details while waiting so small albums can move up the queue
+		if comic, err := p.client.GetComicDetail(comicID); err == nil {
+			p.jobs.SetComic(job, comic)
+		}
+	}
+}
+
+// skippedText tells requesters which pages were left out of a PDF
+func skippedText(pages []int) string {
+	if len(pages) == 0 {
+		return ""
+	}
+	list := make([]string, len(pages))
+	for i, n := range pages {
+		list[i] = strconv.Itoa(n)
+	}
+	return fmt.Sprintf("⚠️ 第 %s 页无法读取，未放入 PDF", strings.Join(list, ", "))
+}
+
+// createPDF builds the PDFs for an album, with a title page if enabled
+func createPDF(ctx context.Context, gen *PDFGenerator, comic *Comic, images []DownloadedImage) ([]string, error) {
+	if gen.config.TitlePage {
+		return gen.CreatePDFWithTitle(ctx, comic, images)
+	}
+	return gen.CreatePDF(ctx, comic, images)
+}
+
+// runJob downloads a queued comic and uploads it to every requester
+func (p *ShowMeJMPlugin) runJob(job *DownloadJob) {
+	bot := p.bot
+	progress := job.Progress
+
+	// Post throttled progress messages until the job is done
+	stopReports := p.reportProgress(job)
+	defer stopReports()
+
+	// Get comic details unless they were fetched while queued
+	progress.SetStage(StageMetadata)
+	comic := p.jobs.Comic(job)
+	if comic == nil {
+		var err error
+		comic, err = p.client.GetComicDetail(job.AlbumID)
+		if err != nil {
+			p.deliver(job, func(msg *pluginsdk.Message) {
+				bot.Reply(msg, pluginsdk.Text(fmt.Sprintf("❌ 获取漫画信息失败: %v", err)))
+			})
+			return
+		}
+		p.jobs.SetComic(job, comic)
+	}
+	if job.Cancelled() {
+		p.finishCancelled(job, nil)
 		return
 	}
 
 	bot.Log("info", fmt.Sprintf("Downloading comic: [%s] %s (%d pages)", comic.ID, comic.Title, comic.Pages))
-	bot.Reply(msg, pluginsdk.Text(fmt.Sprintf("📖 找到漫画: %s\n📄 共 %d 页，正在下载中...", comic.Title, comic.Pages)))
+	for _, msg := range p.jobs.Requesters(job) {
+		bot.Reply(msg, pluginsdk.Text(fmt.Sprintf("📖 找到漫画: %s\n📄 共 %d 页，正在下载中...\n💡 发送 jm进度 %s 查看进度", comic.Title, comic.Pages, comic.ID)))
+	}
 
 	// Download images
-	downloader := NewDownloader(p.client, p.config)
-	images, err := downloader.DownloadComic(comic)
+	progress.SetStage(StageDownload)
+	downloader := NewDownloader(p.client, p.config, p.pool)
+	downloader.SetProgress(progress)
+	downloader.SetPriority(p.jobs.Priority(job))
+	images, err := downloader.DownloadComic(job.Context(), comic)
+	if job.Cancelled() {
+		p.finishCancelled(job, downloader.Created())
+		return
+	}
 	if err != nil {
-		bot.Reply(msg, pluginsdk.Text(fmt.Sprintf("❌ 下载图片失败: %v", err)))
+		p.deliver(job, func(msg *pluginsdk.Message) {
+			bot.Reply(msg, pluginsdk.Text(fmt.Sprintf("❌ 下载图片失败: %v", err)))
+		})
+		return
+	}
+
+	// Drop ad pages and repeated pages
+	images, removed := FilterPages(images, p.ads, p.config)
+	removedText := ""
+	if len(removed) > 0 {
+		pages := make([]string, len(removed))
+		for i, n := range removed {
+			pages[i] = strconv.Itoa(n)
+		}
+		removedText = fmt.Sprintf("🧹 已移除第 %s 页（广告或重复页）", strings.Join(pages, ", "))
+		bot.Log("info", fmt.Sprintf("Removed pages %s from comic %s", strings.Join(pages, ", "), comic.ID))
+	}
+
+	// Create PDF with the first requester's settings
+	progress.SetStage(StagePDF)
+	requesters := p.jobs.Requesters(job)
+	config := p.config
+	if len(requesters) > 0 {
+		config = p.requestConfig(job, requesters[0])
+	}
+	pdfGen := NewPDFGenerator(config)
+	pdfGen.SetProgress(progress)
+	pdfGen.SetLogger(bot.Log)
+	pdfFiles, err := createPDF(job.Context(), pdfGen, comic, images)
+	created := append(downloader.Created(), pdfGen.Created()...)
+	if job.Cancelled() {
+		p.finishCancelled(job, created)
+		return
+	}
+	if err != nil {
+		p.deliver(job, func(msg *pluginsdk.Message) {
+			bot.Reply(msg, pluginsdk.Text(fmt.Sprintf("❌ 创建PDF失败: %v", err)))
+		})
+		return
+	}
+
+	// Tell requesters which pages could not be downloaded
+	missing := downloader.MissingPages()
+	missingText := ""
+	if len(missing) > 0 {
+		pages := make([]string, len(missing))
+		for i, n := range missing {
+			pages[i] = strconv.Itoa(n)
+		}
+		missingText = fmt.Sprintf("⚠️ 第 %s 页下载失败，已用占位页代替", strings.Join(pages, ", "))
+		bot.Log("warn", fmt.Sprintf("Comic %s is missing pages: %s", comic.ID, strings.Join(pages, ", ")))
+	}
+	skipped := len(pdfGen.SkippedPages()) > 0
+
+	// Upload files to every requester, including ones who joined while we
+	// worked. Requesters from groups with other settings get their own PDFs.
+	progress.SetStage(StageUpload)
+	builds := map[string][]string{pdfGen.Variant(): pdfFiles}
+	skippedTexts := map[string]string{pdfGen.Variant(): skippedText(pdfGen.SkippedPages())}
+	p.deliver(job, func(msg *pluginsdk.Message) {
+		// Requesters were told when the job was cancelled
+		if job.Cancelled() {
+			return
+		}
+
+		gen := NewPDFGenerator(p.requestConfig(job, msg))
+		gen.SetLogger(bot.Log)
+		files, ok := builds[gen.Variant()]
+		if !ok {
+			var err error
+			files, err = createPDF(job.Context(), gen, comic, images)
+			created = append(created, gen.Created()...)
+			if job.Cancelled() {
+				return
+			}
+			if err != nil {
+				bot.Reply(msg, pluginsdk.Text(fmt.Sprintf("❌ 创建PDF失败: %v", err)))
+				return
+			}
+			builds[gen.Variant()] = files
+			skippedTexts[gen.Variant()] = skippedText(gen.SkippedPages())
+			skipped = skipped || len(gen.SkippedPages()) > 0
+		}
+
+		if missingText != "" {
+			bot.Reply(msg, pluginsdk.Text(missingText))
+		}
+		if text := skippedTexts[gen.Variant()]; text != "" {
+			bot.Reply(msg, pluginsdk.Text(text))
+		}
+		if removedText != "" {
+			bot.Reply(msg, pluginsdk.Text(removedText))
+		}
+		p.uploadPDFs(job.Context(), bot, msg, comic, gen, files)
+	})
+	if job.Cancelled() {
+		p.finishCancelled(job, created)
+		return
+	}
+	progress.SetStage(StageDone)
+
+	// Don't let a PDF with placeholder or dropped pages be reused by later
+	// requests
+	if len(missing) > 0 || skipped {
+		pdfGen.CleanupPDF(comic)
+	}
+
+	// Cleanup if configured
+	// downloader.CleanupDownload(comic)
+}
+
+// configFor returns the configuration that applies to a message's chat
+func (p *ShowMeJMPlugin) configFor(msg *pluginsdk.Message) *Config {
+	if msg.Type == "group" {
+		return p.config.ForGroup(msg.GroupID)
+	}
+	return p.config
+}
+
+// requestConfig returns the configuration for one requester of a job,
+// including the options given with the request
+func (p *ShowMeJMPlugin) requestConfig(job *DownloadJob, msg *pluginsdk.Message) *Config {
+	return p.jobs.Options(job, msg).Apply(p.configFor(msg))
+}
+
+// finishCancelled winds down a cancelled job: it removes the files the job
+// created if configured and tells anyone who subscribed after the cancel.
+// Pages and PDFs cached by earlier jobs are kept.
+func (p *ShowMeJMPlugin) finishCancelled(job *DownloadJob, created []string) {
+	bot := p.bot
+	bot.Log("info", fmt.Sprintf("Download of %s cancelled at: %s", job.AlbumID, job.Progress.Snapshot()))
+
+	if p.config.CancelCleanup && len(created) > 0 {
+		for _, path := range created {
+			if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+				bot.Log("error", fmt.Sprintf("Failed to remove %s: %v", path, err))
+			}
+		}
+		// Remove the album directory too if this job's files were all it held
+		os.Remove(filepath.Join(p.config.BaseDir, job.AlbumID))
+	}
+
+	p.deliver(job, func(msg *pluginsdk.Message) {
+		bot.Reply(msg, pluginsdk.Text(fmt.Sprintf("🛑 JM%s 的下载已被取消，请稍后重新请求", job.AlbumID)))
+	})
+}
+
+// cancelJob cancels a download on behalf of the message sender
+func (p *ShowMeJMPlugin) cancelJob(bot *pluginsdk.BotClient, msg *pluginsdk.Message, args []string) {
+	if len(args) == 0 {
+		bot.Reply(msg, pluginsdk.Text("📝 取消下载:\n格式: jm取消 [jm号]\n例: jm取消 114514"))
+		return
+	}
+
+	albumID := strings.TrimPrefix(strings.ToUpper(strings.TrimSpace(args[0])), "JM")
+	job, cancelled, err := p.jobs.Cancel(albumID, msg, p.config.IsAdmin(msg.UserID))
+	switch err {
+	case nil:
+	case ErrJobNotFound:
+		bot.Reply(msg, pluginsdk.Text(fmt.Sprintf("😕 没有找到 JM%s 的下载任务", albumID)))
+		return
+	case ErrNotRequester:
+		bot.Reply(msg, pluginsdk.Text("⛔ 只能取消自己请求的下载"))
+		return
+	default:
+		bot.Reply(msg, pluginsdk.Text(fmt.Sprintf("❌ 取消失败: %v", err)))
+		return
+	}
+
+	if !cancelled {
+		bot.Reply(msg, pluginsdk.Text(fmt.Sprintf("👌 已为你取消 JM%s，其他人请求的下载会继续", albumID)))
 		return
 	}
 
+	text := fmt.Sprintf("🛑 已取消 JM%s", albumID)
+	if job.Title != "" {
+		text += " " + job.Title
+	}
+	text += "\n进度: " + job.Progress.Snapshot().String()
 
+	// Let everyone who was waiting know
+	for _, r := range job.Requesters() {
+		if r.Type == msg.Type && r.GroupID == msg.GroupID && r.UserID == msg.UserID {
+			continue
+		}
+		bot.Reply(r, pluginsdk.Text(fmt.Sprintf("%s\n操作者: %s", text, requesterName(msg))))
+	}
+	bot.Reply(msg, pluginsdk.Text(text))
+}
 
-	// Create PDF
-	pdfGen := NewPDFGenerator(p.config)
-	pdfFiles, err := pdfGen.CreatePDF(comic, images)
+// addAdPage adds a downloaded page of an album to the ad library
+func (p *ShowMeJMPlugin) addAdPage(bot *pluginsdk.BotClient, msg *pluginsdk.Message, args []string) {
+	if !p.config.IsAdmin(msg.UserID) {
+		bot.Reply(msg, pluginsdk.Text("⛔ 只有管理员可以标记广告页"))
+		return
+	}
+
+	var page int
+	if len(args) >= 2 {
+		page, _ = strconv.Atoi(args[1])
+	}
+	if page <= 0 {
+		bot.Reply(msg, pluginsdk.Text("📝 标记广告页:\n格式: jm广告 [jm号] [页码]\n例: jm广告 114514 1"))
+		return
+	}
+	albumID := strings.TrimPrefix(strings.ToUpper(strings.TrimSpace(args[0])), "JM")
+
+	// Pages are saved by zero-based index
+	matches, _ := filepath.Glob(filepath.Join(p.config.BaseDir, albumID, fmt.Sprintf("%04d.*", page-1)))
+	path := ""
+	for _, m := range matches {
+		if !strings.HasSuffix(m, placeholderExt) {
+			path = m
+			break
+		}
+	}
+	if path == "" {
+		bot.Reply(msg, pluginsdk.Text(fmt.Sprintf("😕 没有找到 JM%s 第 %d 页，请先下载该本子", albumID, page)))
+		return
+	}
+
+	hash, err := hashFile(path)
 	if err != nil {
-		bot.Reply(msg, pluginsdk.Text(fmt.Sprintf("❌ 创建PDF失败: %v", err)))
+		bot.Reply(msg, pluginsdk.Text(fmt.Sprintf("❌ 读取图片失败: %v", err)))
 		return
 	}
 
+	added, err := p.ads.Add(hash, albumID, page, msg.UserID, p.config.AdHashThreshold)
+	if err != nil {
+		bot.Reply(msg, pluginsdk.Text(fmt.Sprintf("❌ 保存广告库失败: %v", err)))
+		return
+	}
+	if !added {
+		bot.Reply(msg, pluginsdk.Text("👌 这一页已经在广告库中了"))
+		return
+	}
+
+	bot.Log("info", fmt.Sprintf("Ad page added from %s page %d: %016x", albumID, page, hash))
+	text := fmt.Sprintf("✅ 已将 JM%s 第 %d 页加入广告库（共 %d 条）", albumID, page, p.ads.Len())
+	if !p.config.AdFilter {
+		text += "\n⚠️ 广告过滤未开启（ad_filter）"
+	}
+	bot.Reply(msg, pluginsdk.Text(text))
+}
+
+// reportProgress periodically sends a job's progress to its requesters.
+// It returns a function that stops the reports.
+func (p *ShowMeJMPlugin) reportProgress(job *DownloadJob) func() {
+	if p.config.ProgressInterval <= 0 {
+		return func() {}
+	}
+
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(time.Duration(p.config.ProgressInterval) * time.Second)
+		defer ticker.Stop()
+
+		last := ""
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+
+			snapshot := job.Progress.Snapshot()
+			if snapshot.Stage == StageMetadata || snapshot.Stage == StageUpload {
+				continue
+			}
+			text := snapshot.String()
+			if text == last {
+				continue
+			}
+			last = text
+
+			for _, msg := range p.jobs.Requesters(job) {
+				p.bot.Reply(msg, pluginsdk.Text(fmt.Sprintf("⏱️ JM%s %s", job.AlbumID, text)))
+			}
+		}
+	}()
+
+	return func() { close(done) }
+}
+
+// deliver calls fn for every requester of a job, including requesters that
+// subscribe while fn is running, and then retires the job
+func (p *ShowMeJMPlugin) deliver(job *DownloadJob, fn func(msg *pluginsdk.Message)) {
+	requesters := p.jobs.Requesters(job)
+	served := make(map[*pluginsdk.Message]bool)
+	for {
+		for _, msg := range requesters {
+			fn(msg)
+			served[msg] = true
+		}
+		requesters = p.jobs.Complete(job, served)
+		if len(requesters) == 0 {
+			return
+		}
+	}
+}
+
+// uploadPDFs uploads generated PDF files to the chat a message came from.
+// Files not started when ctx is cancelled are not uploaded.
+func (p *ShowMeJMPlugin) uploadPDFs(ctx context.Context, bot *pluginsdk.BotClient, msg *pluginsdk.Message, comic *Comic, gen *PDFGenerator, pdfFiles []string) {
+	for _, pdfPath := range pdfFiles {
+		if ctx.Err() != nil {
+			return
+		}
 
-	// Upload files using BotClient
-	
-	for i, pdfPath := range pdfFiles {
 		// Check file exists and has size
 		info, err := os.Stat(pdfPath)
 		if err != nil {
@@ -240,10 +666,7 @@ func (p *ShowMeJMPlugin) downloadComic(ctx context.Context, bot *pluginsdk.BotCl
 			continue
 		}
 
-		fileName := fmt.Sprintf("%s-%d.pdf", comic.ID, i+1)
-		if len(pdfFiles) == 1 {
-			fileName = fmt.Sprintf("%s.pdf", comic.ID)
-		}
+		fileName := gen.UploadName(comic, pdfPath)
 
 		bot.Log("info", fmt.Sprintf("Uploading PDF: %s (%d bytes)", fileName, info.Size()))
 
@@ -257,15 +680,72 @@ func (p *ShowMeJMPlugin) downloadComic(ctx context.Context, bot *pluginsdk.BotCl
 		if uploadErr != nil {
 			bot.Reply(msg, pluginsdk.Text(fmt.Sprintf("❌ 上传文件失败: %v", uploadErr)))
 			bot.Log("error", fmt.Sprintf("Upload failed: %v", uploadErr))
-			
 		} else {
 			bot.Log("info", fmt.Sprintf("Uploaded: %s", fileName))
 		}
 	}
+}
 
+// showProgress shows the progress of one job, or of all jobs without an ID
+func (p *ShowMeJMPlugin) showProgress(bot *pluginsdk.BotClient, msg *pluginsdk.Message, args []string) {
+	if len(args) == 0 {
+		jobs := p.jobs.List()
+		if len(jobs) == 0 {
+			bot.Reply(msg, pluginsdk.Text("📭 当前没有下载任务"))
+			return
+		}
 
-	// Cleanup if configured
-	// downloader.CleanupDownload(comic)
+		var sb strings.Builder
+		sb.WriteString("⏱️ 下载进度\n")
+		sb.WriteString("━━━━━━━━━━━━━━━━\n")
+		for _, job := range jobs {
+			sb.WriteString(fmt.Sprintf("[JM%s] %s\n", job.AlbumID, job.Progress.Snapshot()))
+		}
+		sb.WriteString("━━━━━━━━━━━━━━━━")
+		bot.Reply(msg, pluginsdk.Text(sb.String()))
+		return
+	}
+
+	albumID := strings.TrimPrefix(strings.ToUpper(strings.TrimSpace(args[0])), "JM")
+	job, ok := p.jobs.Find(albumID)
+	if !ok {
+		bot.Reply(msg, pluginsdk.Text(fmt.Sprintf("😕 没有找到 JM%s 的下载任务", albumID)))
+		return
+	}
+
+	snapshot := job.Progress.Snapshot()
+	text := fmt.Sprintf("⏱️ [JM%s] %s\n%s", job.AlbumID, job.Title, snapshot)
+	if snapshot.Elapsed > 0 {
+		text += "\n已用时 " + formatDuration(snapshot.Elapsed)
+	}
+	bot.Reply(msg, pluginsdk.Text(text))
+}
+
+// showQueue lists queued and running download jobs
+func (p *ShowMeJMPlugin) showQueue(bot *pluginsdk.BotClient, msg *pluginsdk.Message) {
+	jobs := p.jobs.List()
+	if len(jobs) == 0 {
+		bot.Reply(msg, pluginsdk.Text("📭 当前没有下载任务"))
+		return
+	}
+
+	var sb strings.Builder
+	sb.WriteString("📋 下载队列\n")
+	sb.WriteString("━━━━━━━━━━━━━━━━\n")
+	for i, job := range jobs {
+		state := "⏳ 排队中"
+		if job.State == JobRunning {
+			state = "⬇️ 下载中"
+		}
+		title := job.Title
+		if title == "" {
+			title = "(获取信息中)"
+		}
+		sb.WriteString(fmt.Sprintf("%d. [JM%s] %s\n   %s | 请求者: %s\n", i+1, job.AlbumID, title, state, job.RequesterNames()))
+	}
+	sb.WriteString("━━━━━━━━━━━━━━━━")
+
+	bot.Reply(msg, pluginsdk.Text(sb.String()))
 }
 
 // searchComic searches for comics
@@ -330,7 +810,7 @@ func (p *ShowMeJMPlugin) randomComic(ctx context.Context, bot *pluginsdk.BotClie
 	}
 
 	bot.Reply(msg, pluginsdk.Text(fmt.Sprintf("🎯 你今天的幸运本子是:\n[JM%s] %s\n\n即将开始下载...", comic.ID, comic.Title)))
-	p.downloadComic(ctx, bot, msg, comic.ID)
+	p.downloadComic(ctx, bot, msg, comic.ID, nil)
 }
 
 // updateDomains checks and updates available domains
@@ -396,5 +876,10 @@ func (p *ShowMeJMPlugin) setDomain(ctx context.Context, bot *pluginsdk.BotClient
 }
 
 func main() {
+	// Offline tools work on local files without starting the plugin SDK
+	if handled, code := runCLI(os.Args[1:]); handled {
+		os.Exit(code)
+	}
+
 	pluginsdk.Run(&ShowMeJMPlugin{})
 }
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"sync"
+)
+
+// MemoryBudget limits how many bytes of decoded image data may be held at
+// once across all download workers.
+// A nil *MemoryBudget means no limit.
+type MemoryBudget struct {
+	mu    sync.Mutex
+	cond  *sync.Cond
+	limit int64
+	used  int64
+}
+
+// NewMemoryBudget creates a budget of limit bytes (0 or less means no limit)
+func NewMemoryBudget(limit int64) *MemoryBudget {
+	if limit <= 0 {
+		return nil
+	}
+	b := &MemoryBudget{limit: limit}
+	b.cond = sync.NewCond(&b.mu)
+	return b
+}
+
+// Acquire blocks until n bytes are available.
+// Requests larger than the whole budget wait until nothing else is held.
+func (b *MemoryBudget) Acquire(n int64) {
+	if b == nil {
+		return
+	}
+	n = b.clamp(n)
+
+	b.mu.Lock()
+	for b.used > 0 && b.used+n > b.limit {
+		b.cond.Wait()
+	}
+	b.used += n
+	b.mu.Unlock()
+}
+
+// Release returns n bytes previously acquired
+func (b *MemoryBudget) Release(n int64) {
+	if b == nil {
+		return
+	}
+	n = b.clamp(n)
+
+	b.mu.Lock()
+	b.used -= n
+	b.cond.Broadcast()
+	b.mu.Unlock()
+}
+
+// clamp limits a request to the size of the budget
+func (b *MemoryBudget) clamp(n int64) int64 {
+	if n > b.limit {
+		return b.limit
+	}
+	return n
+}
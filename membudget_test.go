@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// acquired runs b.Acquire(n) in the background and returns a channel that
+// is closed once it returns
+func acquired(b *MemoryBudget, n int64) <-chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		b.Acquire(n)
+		close(done)
+	}()
+	return done
+}
+
+// budgetUsed returns the bytes currently held
+func budgetUsed(b *MemoryBudget) int64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.used
+}
+
+// blocked reports whether done stays open for a short while
+func blocked(done <-chan struct{}) bool {
+	select {
+	case <-done:
+		return false
+	case <-time.After(50 * time.Millisecond):
+		return true
+	}
+}
+
+func TestMemoryBudgetBlocksAboveLimit(t *testing.T) {
+	b := NewMemoryBudget(100)
+	b.Acquire(60)
+	b.Acquire(40) // Exactly at the limit
+
+	done := acquired(b, 10)
+	if !blocked(done) {
+		t.Fatal("Acquire above the limit did not block")
+	}
+
+	b.Release(40)
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Acquire did not resume after Release")
+	}
+	if used := budgetUsed(b); used != 70 {
+		t.Errorf("used = %d, want 70", used)
+	}
+}
+
+func TestMemoryBudgetOversizedRequest(t *testing.T) {
+	b := NewMemoryBudget(100)
+
+	// A request over the whole budget runs alone instead of waiting forever
+	b.Acquire(500)
+	done := acquired(b, 1)
+	if !blocked(done) {
+		t.Fatal("Acquire next to an oversized request did not block")
+	}
+	b.Release(500)
+	<-done
+	b.Release(1)
+	if used := budgetUsed(b); used != 0 {
+		t.Errorf("used = %d after releasing everything, want 0", used)
+	}
+}
+
+func TestMemoryBudgetNilIsUnlimited(t *testing.T) {
+	b := NewMemoryBudget(0)
+	if b != nil {
+		t.Fatal("a zero limit should give no budget")
+	}
+	b.Acquire(1 << 40)
+	b.Release(1 << 40)
+}
+
+func TestDownloadComicWaitsForMemoryBudget(t *testing.T) {
+	const pages = 6
+	page := testPageData(t, 100, 120, "png")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(page)
+	}))
+	defer server.Close()
+
+	config := DefaultConfig()
+	config.BaseDir = t.TempDir()
+	comic := &Comic{ID: "budget", Pages: pages, Chapters: []Chapter{{ID: "1", ScrambleID: "220980"}}}
+	for i := 0; i < pages; i++ {
+		comic.Chapters[0].ImageURLs = append(comic.Chapters[0].ImageURLs, fmt.Sprintf("%s/%05d.png", server.URL, i+1))
+	}
+
+	limit := decodeCost(page) * 2
+	pool := NewDownloadPool(4, limit)
+	defer pool.Close()
+
+	// Hold the whole budget so every worker has to wait before decoding
+	pool.Memory().Acquire(limit)
+	result := make(chan error, 1)
+	var images []DownloadedImage
+	go func() {
+		var err error
+		images, err = NewDownloader(NewJMClient(config), config, pool).DownloadComic(context.Background(), comic)
+		result <- err
+	}()
+
+	time.Sleep(200 * time.Millisecond)
+	if saved, _ := filepath.Glob(filepath.Join(config.BaseDir, comic.ID, "*.png")); len(saved) > 0 {
+		t.Fatalf("%d pages were decoded while the memory budget was exhausted", len(saved))
+	}
+	select {
+	case err := <-result:
+		t.Fatalf("download finished while the memory budget was exhausted: %v", err)
+	default:
+	}
+
+	pool.Memory().Release(limit)
+	select {
+	case err := <-result:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("download did not resume after the budget was released")
+	}
+	if len(images) != pages {
+		t.Errorf("got %d pages, want %d", len(images), pages)
+	}
+	if used := budgetUsed(pool.Memory()); used != 0 {
+		t.Errorf("%d bytes of the budget still held after the download", used)
+	}
+}
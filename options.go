@@ -0,0 +1,72 @@
+package main
+
+import (
+	"strings"
+)
+
+// DownloadOptions are per-request settings given after the album ID,
+// e.g. "jm 114514 长条"
+type DownloadOptions struct {
+	LongStrip        string // Overrides the long-strip mode if set
+	PageLayout       string // Overrides the page layout if set
+	PageDisplay      string // Overrides single or two-page display if set
+	ReadingDirection string // Overrides the reading direction if set
+}
+
+// downloadOptionWords maps option words to the setting they change
+var downloadOptionWords = map[string]func(o *DownloadOptions){
+	"长条":       func(o *DownloadOptions) { o.LongStrip = LongStripOn },
+	"strip":    func(o *DownloadOptions) { o.LongStrip = LongStripOn },
+	"分页":       func(o *DownloadOptions) { o.LongStrip = LongStripOff },
+	"nostrip":  func(o *DownloadOptions) { o.LongStrip = LongStripOff },
+	"原图":       func(o *DownloadOptions) { o.PageLayout = PageLayoutOriginal },
+	"original": func(o *DownloadOptions) { o.PageLayout = PageLayoutOriginal },
+	"a4":       func(o *DownloadOptions) { o.PageLayout = PageLayoutA4 },
+	"等宽":       func(o *DownloadOptions) { o.PageLayout = PageLayoutWidth },
+	"width":    func(o *DownloadOptions) { o.PageLayout = PageLayoutWidth },
+	"双页":       func(o *DownloadOptions) { o.PageDisplay = PageDisplayTwo },
+	"twopage":  func(o *DownloadOptions) { o.PageDisplay = PageDisplayTwo },
+	"单页":       func(o *DownloadOptions) { o.PageDisplay = PageDisplaySingle },
+	"single":   func(o *DownloadOptions) { o.PageDisplay = PageDisplaySingle },
+	"右翻":       func(o *DownloadOptions) { o.ReadingDirection = ReadingRTL },
+	"rtl":      func(o *DownloadOptions) { o.ReadingDirection = ReadingRTL },
+	"左翻":       func(o *DownloadOptions) { o.ReadingDirection = ReadingLTR },
+	"ltr":      func(o *DownloadOptions) { o.ReadingDirection = ReadingLTR },
+}
+
+// ParseDownloadOptions parses option words and returns the words it did
+// not recognize
+func ParseDownloadOptions(args []string) (DownloadOptions, []string) {
+	var opts DownloadOptions
+	unknown := make([]string, 0)
+	for _, arg := range args {
+		if set, ok := downloadOptionWords[strings.ToLower(arg)]; ok {
+			set(&opts)
+		} else {
+			unknown = append(unknown, arg)
+		}
+	}
+	return opts, unknown
+}
+
+// Apply returns the configuration with the options applied
+func (o DownloadOptions) Apply(config *Config) *Config {
+	if o == (DownloadOptions{}) {
+		return config
+	}
+
+	cp := *config
+	if o.LongStrip != "" {
+		cp.Processing.LongStrip = o.LongStrip
+	}
+	if o.PageLayout != "" {
+		cp.Processing.PageLayout = o.PageLayout
+	}
+	if o.PageDisplay != "" {
+		cp.Processing.PageDisplay = o.PageDisplay
+	}
+	if o.ReadingDirection != "" {
+		cp.Processing.ReadingDirection = o.ReadingDirection
+	}
+	return &cp
+}
@@ -2,23 +2,75 @@ package main
 
 import (
 	"bytes"
+	"compress/zlib"
+	"context"
+	"errors"
 	"fmt"
+	"hash/fnv"
 	"image"
+	"image/color"
 	"image/draw"
 	_ "image/gif"
 	"image/jpeg"
 	_ "image/png"
 	"os"
 	"path/filepath"
+	"sort"
 
 	"github.com/pdfcpu/pdfcpu/pkg/api"
 	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
-	"github.com/signintech/gopdf"
+	_ "golang.org/x/image/webp"
 )
 
 // PDFGenerator handles PDF creation
 type PDFGenerator struct {
-	config *Config
+	config    *Config
+	progress  *Progress
+	logger    func(level, message string)
+	longStrip bool          // Set by CreatePDF when pages are stitched into a strip
+	target    *sizeTarget   // Compression used while fitting a size budget
+	chapters  []chapterMark // Set by CreatePDF for multi-chapter albums
+	continues bool          // The first chapter of the current part began in the previous part
+	info      PDFInfo       // Set by CreatePDF for the current part
+	titlePage *PDFImage     // Set by CreatePDFWithTitle, starts every part
+	created   []string      // PDFs written by this generator, cached ones excluded
+	skipped   []int         // Pages left out because they could not be read or encoded
+}
+
+// chapterMark is where a chapter starts in the album's images
+type chapterMark struct {
+	start int // Index of the chapter's first image
+	title string
+}
+
+// chapterMarks returns the chapter starts of an album, or nil if it has
+// fewer than two chapters and needs no outline
+func chapterMarks(comic *Comic) []chapterMark {
+	if len(comic.Chapters) < 2 {
+		return nil
+	}
+
+	marks := make([]chapterMark, 0, len(comic.Chapters))
+	start := 0
+	for _, chapter := range comic.Chapters {
+		if len(chapter.ImageURLs) > 0 {
+			marks = append(marks, chapterMark{start: start, title: chapter.Title})
+		}
+		start += len(chapter.ImageURLs)
+	}
+	return marks
+}
+
+// chapterOf returns the position in p.chapters of the chapter containing
+// an image index, or -1 if there are no chapters
+func (p *PDFGenerator) chapterOf(index int) int {
+	chapter := -1
+	for i, mark := range p.chapters {
+		if mark.start <= index {
+			chapter = i
+		}
+	}
+	return chapter
 }
 
 // NewPDFGenerator creates a new PDF generator
@@ -28,8 +80,73 @@ func NewPDFGenerator(config *Config) *PDFGenerator {
 	}
 }
 
-// CreatePDF creates PDF files from downloaded images
-func (p *PDFGenerator) CreatePDF(comic *Comic, images []DownloadedImage) ([]string, error) {
+// SetProgress sets the tracker that receives PDF progress
+func (p *PDFGenerator) SetProgress(progress *Progress) {
+	p.progress = progress
+}
+
+// SetLogger sets the function that receives log messages
+func (p *PDFGenerator) SetLogger(logger func(level, message string)) {
+	p.logger = logger
+}
+
+// logf logs a formatted message if a logger is set
+func (p *PDFGenerator) logf(level, format string, args ...interface{}) {
+	if p.logger != nil {
+		p.logger(level, fmt.Sprintf(format, args...))
+	}
+}
+
+// Variant returns a file name suffix identifying settings that change the
+// PDF content, so PDFs built with different settings are cached separately
+func (p *PDFGenerator) Variant() string {
+	variant := ""
+	if key := p.config.Processing.Key(); key != "" {
+		variant += "-" + key
+	}
+	if p.config.TitlePage {
+		variant += "-title"
+	}
+	if p.config.PDFTargetSizeMB > 0 {
+		variant += fmt.Sprintf("-%dmb", p.config.PDFTargetSizeMB)
+		if p.config.TargetDownscale {
+			variant += "s"
+		}
+	}
+	return variant
+}
+
+// removedKey returns a file name suffix identifying the album pages left
+// out of images, such as pages removed as ads, or "" if none are. PDFs
+// built after the ad library changes get a new name instead of the cached
+// file with the old pages.
+func removedKey(comic *Comic, images []DownloadedImage) string {
+	total := 0
+	for _, chapter := range comic.Chapters {
+		total += len(chapter.ImageURLs)
+	}
+	kept := make(map[int]bool, len(images))
+	for _, img := range images {
+		kept[img.Index] = true
+	}
+
+	hash := fnv.New32a()
+	removed := 0
+	for i := 0; i < total; i++ {
+		if !kept[i] {
+			fmt.Fprintf(hash, "%d,", i)
+			removed++
+		}
+	}
+	if removed == 0 {
+		return ""
+	}
+	return fmt.Sprintf("-r%08x", hash.Sum32())
+}
+
+// CreatePDF creates PDF files from downloaded images.
+// Cancelling ctx stops at the next page and removes the unfinished file.
+func (p *PDFGenerator) CreatePDF(ctx context.Context, comic *Comic, images []DownloadedImage) ([]string, error) {
 	if len(images) == 0 {
 		return nil, fmt.Errorf("no images to convert")
 	}
@@ -40,48 +157,66 @@ func (p *PDFGenerator) CreatePDF(comic *Comic, images []DownloadedImage) ([]stri
 	}
 
 	pdfFiles := make([]string, 0)
-
-	// Calculate how many PDFs we need
-	maxPages := p.config.PDFMaxPages
-	if maxPages <= 0 {
-		maxPages = len(images)
+	p.progress.SetTotal(len(images))
+	p.chapters = chapterMarks(comic)
+	info := documentInfo(comic)
+	removed := removedKey(comic, images)
+
+	// Vertical-scroll comics are stitched and re-cut into pages
+	switch p.config.Processing.LongStrip {
+	case LongStripOn:
+		p.longStrip = true
+	case LongStripAuto:
+		p.longStrip = detectLongStrip(images)
+	default:
+		p.longStrip = false
 	}
 
-	// Split images into chunks
-	totalChunks := (len(images) + maxPages - 1) / maxPages
-	for chunkIdx := 0; chunkIdx < totalChunks; chunkIdx++ {
-		start := chunkIdx * maxPages
-		end := start + maxPages
-		if end > len(images) {
-			end = len(images)
-		}
+	// Split images into files
+	parts := p.splitParts(images)
+	for partIdx, part := range parts {
+		chunk := part.images
+		p.continues = part.start > 0 && p.chapterOf(images[part.start-1].Index) == p.chapterOf(chunk[0].Index)
 
-		chunk := images[start:end]
+		p.info = info
+		if len(parts) > 1 {
+			p.info.Title = fmt.Sprintf("%s (%d/%d)", info.Title, partIdx+1, len(parts))
+		}
 
 		// Generate PDF filename
 		var pdfPath string
-		if totalChunks == 1 {
-			pdfPath = filepath.Join(pdfDir, fmt.Sprintf("%s.pdf", comic.ID))
+		if part.label == "" {
+			pdfPath = filepath.Join(pdfDir, fmt.Sprintf("%s%s%s.pdf", comic.ID, p.Variant(), removed))
 		} else {
-			pdfPath = filepath.Join(pdfDir, fmt.Sprintf("%s-part%d.pdf", comic.ID, chunkIdx+1))
+			pdfPath = filepath.Join(pdfDir, fmt.Sprintf("%s-%s%s%s.pdf", comic.ID, part.label, p.Variant(), removed))
 		}
 
 		// Check if PDF already exists and has correct size
 		if info, err := os.Stat(pdfPath); err == nil && info.Size() > 1024 {
+			for range chunk {
+				p.progress.AddPage()
+			}
 			pdfFiles = append(pdfFiles, pdfPath)
 			continue
 		}
 
-		// Create PDF
-		if err := p.createSinglePDF(pdfPath, chunk); err != nil {
+		// Create PDF, within the size budget if one is configured
+		create := p.createSinglePDF
+		if p.config.PDFTargetSizeMB > 0 {
+			create = p.createTargetPDF
+		}
+		if err := create(ctx, pdfPath, chunk); err != nil {
 			return nil, fmt.Errorf("failed to create PDF %s: %w", pdfPath, err)
 		}
+		p.created = append(p.created, pdfPath)
 
 		// Encrypt PDF if password is configured
-		if p.config.PDFPassword != "" {
-			if err := p.encryptPDF(pdfPath, p.config.PDFPassword); err != nil {
+		if p.config.EncryptsPDF() {
+			p.progress.SetStage(StageEncrypt)
+			if err := p.encryptPDF(pdfPath); err != nil {
 				return nil, fmt.Errorf("failed to encrypt PDF %s: %w", pdfPath, err)
 			}
+			p.progress.SetStage(StagePDF)
 		}
 
 		pdfFiles = append(pdfFiles, pdfPath)
@@ -90,142 +225,414 @@ func (p *PDFGenerator) CreatePDF(comic *Comic, images []DownloadedImage) ([]stri
 	return pdfFiles, nil
 }
 
-// createSinglePDF creates a single PDF from images
-func (p *PDFGenerator) createSinglePDF(pdfPath string, images []DownloadedImage) error {
-	pdf := gopdf.GoPdf{}
-	pdf.Start(gopdf.Config{PageSize: *gopdf.PageSizeA4})
-
-	// Track temp files for cleanup at the end
-	var tempFiles []string
-	defer func() {
-		for _, tf := range tempFiles {
-			os.Remove(tf)
+// createSinglePDF creates a single PDF from images.
+// Pages are read, normalized and written one at a time so memory use does
+// not grow with the number of pages.
+func (p *PDFGenerator) createSinglePDF(ctx context.Context, pdfPath string, images []DownloadedImage) error {
+	pdf, err := NewPDFWriter(pdfPath)
+	if err != nil {
+		return fmt.Errorf("failed to create PDF: %w", err)
+	}
+	pdf.SetInfo(p.info)
+	pdf.SetViewerPreferences(p.config.Processing.ViewerRightToLeft(), p.config.Processing.PageDisplay == PageDisplayTwo)
+	if p.titlePage != nil {
+		if err := p.addPDFPage(pdf, *p.titlePage); err != nil {
+			pdf.Abort()
+			return fmt.Errorf("failed to write title page: %w", err)
 		}
-	}()
+	}
 
 	// Process images
-	for _, img := range images {
-		var imagePath string
-		var needCompress bool = p.config.ImageQuality > 0 && p.config.ImageQuality < 100
-
-		// Read original image data - we always need this for normalization
-		var imgData []byte
-		var err error
-		if len(img.Data) > 0 {
-			imgData = img.Data
-		} else {
-			imgData, err = os.ReadFile(img.Path)
-			if err != nil {
-				// Skip this image if can't read
-				continue
-			}
+	var pending *pageSource // Page waiting for its facing page when merging spreads
+	var strip *stripBuilder
+	if p.longStrip {
+		strip = newStripBuilder(p.config.Processing.StripPageRatio)
+	}
+	chapter := -1
+	var marks []pendingBookmark
+	for i, img := range images {
+		if err := ctx.Err(); err != nil {
+			pdf.Abort()
+			return err
 		}
 
-		if needCompress {
-			// Compress image (also normalizes color space)
-			compressedData, err := p.compressImage(imgData, p.config.ImageQuality)
-			if err != nil {
-				// If compression fails, try normalization only
-				normalizedData, normErr := p.normalizeImage(imgData)
-				if normErr != nil {
-					// If normalization also fails, use original path
-					imagePath = img.Path
-				} else {
-					tempFile := img.Path + ".normalized.jpg"
-					if writeErr := os.WriteFile(tempFile, normalizedData, 0644); writeErr != nil {
-						imagePath = img.Path
-					} else {
-						imagePath = tempFile
-						tempFiles = append(tempFiles, tempFile)
-					}
-				}
-			} else {
-				// Write compressed data to temp file
-				tempFile := img.Path + ".compressed.jpg"
-				if writeErr := os.WriteFile(tempFile, compressedData, 0644); writeErr != nil {
-					// If write fails, use original path
-					imagePath = img.Path
-				} else {
-					imagePath = tempFile
-					tempFiles = append(tempFiles, tempFile)
-				}
+		src, err := readPage(img.Path)
+		if err != nil {
+			p.skipPage(img.Index+1, err)
+			p.progress.AddPage()
+			continue
+		}
+		src.page = img.Index + 1
+
+		// Bookmark each chapter where its first page lands. A chapter that
+		// began in the previous part is bookmarked at the start of this one.
+		if c := p.chapterOf(img.Index); c != chapter && c >= 0 {
+			title := p.chapters[c].title
+			if chapter < 0 && p.continues {
+				title += "（续）"
 			}
+			marks = append(marks, pendingBookmark{page: src.page, title: title})
+			chapter = c
+		}
+
+		var pages []PDFImage
+		if strip != nil {
+			pages = p.stripPages(strip, src)
 		} else {
-			// Even without compression, normalize the image to fix color space issues
-			normalizedData, err := p.normalizeImage(imgData)
-			if err != nil {
-				// If normalization fails, use original path
-				imagePath = img.Path
-			} else {
-				tempFile := img.Path + ".normalized.jpg"
-				if writeErr := os.WriteFile(tempFile, normalizedData, 0644); writeErr != nil {
-					imagePath = img.Path
-				} else {
-					imagePath = tempFile
-					tempFiles = append(tempFiles, tempFile)
-				}
-			}
+			pages = p.layoutPage(src, &pending, i == 0)
+		}
+		if err := p.writePages(pdf, pages, &marks); err != nil {
+			pdf.Abort()
+			return err
 		}
+		p.progress.AddPage()
+	}
 
-		// Read image file to get dimensions
-		imgFile, err := os.Open(imagePath)
-		if err != nil {
-			continue
+	var last []PDFImage
+	if strip != nil {
+		last = p.encodeStripPages(strip.flush())
+	} else {
+		last = p.flushPending(&pending)
+	}
+	if err := p.writePages(pdf, last, &marks); err != nil {
+		pdf.Abort()
+		return err
+	}
+
+	// Save PDF
+	if err := pdf.Close(); err != nil {
+		os.Remove(pdfPath)
+		return fmt.Errorf("failed to write PDF: %w", err)
+	}
+
+	return nil
+}
+
+// pendingBookmark is a chapter waiting for the PDF page that shows the
+// album page it starts at
+type pendingBookmark struct {
+	page  int // Album page number
+	title string
+}
+
+// writePages adds laid-out pages to the PDF and bookmarks each chapter at
+// the first page showing its first album page. Merged spreads and strips
+// can put that page after other chapters' pages or on a later PDF page.
+func (p *PDFGenerator) writePages(pdf *PDFWriter, pages []PDFImage, marks *[]pendingBookmark) error {
+	for _, page := range pages {
+		// A chapter whose first page was dropped starts at the next one
+		last := 0
+		for _, n := range page.Sources {
+			if n > last {
+				last = n
+			}
+		}
+		for len(*marks) > 0 && (*marks)[0].page <= last {
+			pdf.AddBookmark((*marks)[0].title, pdf.PageCount())
+			*marks = (*marks)[1:]
 		}
 
-		imgConfig, _, err := image.DecodeConfig(imgFile)
-		imgFile.Close()
-		if err != nil {
-			// Skip images that can't be decoded
-			continue
+		if err := p.addPDFPage(pdf, page); err != nil {
+			return fmt.Errorf("failed to write page: %w", err)
 		}
+	}
+	return nil
+}
 
-		// Calculate page dimensions
-		pageWidth := float64(imgConfig.Width)
-		pageHeight := float64(imgConfig.Height)
+// A4 at 150 DPI, the page box of the "a4" layout
+const (
+	a4PageWidth  = 1240.0
+	a4PageHeight = 1754.0
+)
 
-		// Scale to reasonable PDF dimensions (max A4 at 150 DPI)
-		maxWidth := 1240.0  // A4 width at 150 DPI
-		maxHeight := 1754.0 // A4 height at 150 DPI
+// defaultPageWidth is the page width of the "width" layout if none is set
+const defaultPageWidth = int(a4PageWidth)
+
+// addPDFPage adds a page sized by the page layout. Landscape pages such as
+// spreads get twice the width of a portrait page.
+func (p *PDFGenerator) addPDFPage(pdf *PDFWriter, page PDFImage) error {
+	// Calculate page dimensions
+	pageWidth := float64(page.Width)
+	pageHeight := float64(page.Height)
+	landscape := pageWidth > pageHeight
+
+	scale := 1.0
+	switch p.config.Processing.PageLayout {
+	case PageLayoutOriginal:
+		// One PDF unit per pixel
+
+	case PageLayoutWidth:
+		width := float64(p.config.Processing.PageWidth)
+		if landscape {
+			width *= 2
+		}
+		scale = width / pageWidth
 
-		scale := 1.0
+	default:
+		// Shrink to fit A4, small pages keep their size
+		maxWidth := a4PageWidth
+		if landscape {
+			maxWidth *= 2
+		}
 		if pageWidth > maxWidth {
 			scale = maxWidth / pageWidth
 		}
-		if pageHeight*scale > maxHeight {
-			scale = maxHeight / pageHeight
+		if pageHeight*scale > a4PageHeight {
+			scale = a4PageHeight / pageHeight
 		}
+	}
 
-		pageWidth *= scale
-		pageHeight *= scale
+	pageWidth *= scale
+	pageHeight *= scale
+
+	// Ensure minimum size
+	if pageWidth < 100 {
+		pageWidth = 100
+	}
+	if pageHeight < 100 {
+		pageHeight = 100
+	}
 
-		// Ensure minimum size
-		if pageWidth < 100 {
-			pageWidth = 100
+	// Add page with the image
+	return pdf.AddImagePage(page, pageWidth, pageHeight)
+}
+
+// pageSource is a page file read for the PDF, decoded only when needed
+type pageSource struct {
+	page   int // Page number in the album
+	data   []byte
+	img    image.Image
+	format string
+	width  int
+	height int
+}
+
+// readPage reads an image file and its dimensions
+func readPage(path string) (*pageSource, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode image: %w", err)
+	}
+
+	return &pageSource{
+		data:   data,
+		format: format,
+		width:  cfg.Width,
+		height: cfg.Height,
+	}, nil
+}
+
+// decode decodes the page once and keeps the result
+func (s *pageSource) decode() (image.Image, error) {
+	if s.img != nil {
+		return s.img, nil
+	}
+	img, _, err := image.Decode(bytes.NewReader(s.data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode image: %w", err)
+	}
+	s.img = img
+	return img, nil
+}
+
+// preparePage converts a page to data ready to embed.
+// Baseline gray or RGB JPEGs are embedded untouched and other formats are
+// stored losslessly, so pages are not re-encoded here; compression is
+// applied once when the image is downloaded.
+func (p *PDFGenerator) preparePage(src *pageSource) (PDFImage, error) {
+	if p.target != nil {
+		img, err := src.decode()
+		if err != nil {
+			return PDFImage{}, err
 		}
-		if pageHeight < 100 {
-			pageHeight = 100
+		img, _ = processImage(img, p.config.Processing)
+		return p.targetPage(img, src.data)
+	}
+
+	// Processed pages are encoded once more, untouched ones pass through
+	if p.config.Processing.Enabled() {
+		img, err := src.decode()
+		if err != nil {
+			return PDFImage{}, err
+		}
+		if processed, changed := processImage(img, p.config.Processing); changed {
+			return p.encodePage(processed, src.format)
 		}
+	}
 
-		// Add page with custom size
-		pdf.AddPageWithOption(gopdf.PageOption{
-			PageSize: &gopdf.Rect{W: pageWidth, H: pageHeight},
-		})
+	if page, ok := jpegPassthrough(src.data); ok {
+		return page, nil
+	}
 
-		// Add image to PDF
-		err = pdf.Image(imagePath, 0, 0, &gopdf.Rect{W: pageWidth, H: pageHeight})
-		if err != nil {
-			// Skip this image if it fails
+	img, err := src.decode()
+	if err != nil {
+		return PDFImage{}, err
+	}
+
+	if src.format != "jpeg" {
+		return flateImage(img)
+	}
+
+	// Progressive or CMYK JPEGs are normalized to a baseline RGB JPEG
+	normalized, err := p.normalizeImage(src.data)
+	if err != nil {
+		return PDFImage{}, err
+	}
+	bounds := img.Bounds()
+	return PDFImage{
+		Data:       normalized,
+		Width:      bounds.Dx(),
+		Height:     bounds.Dy(),
+		Components: 3,
+		Filter:     "DCTDecode",
+	}, nil
+}
+
+// encodePage encodes a modified page, losslessly if the source was
+// lossless and as JPEG otherwise. While fitting a size budget every page
+// is a JPEG with the chosen settings.
+func (p *PDFGenerator) encodePage(img image.Image, format string) (PDFImage, error) {
+	if p.target != nil {
+		return jpegImage(scaleImage(img, p.target.scale), p.target.quality)
+	}
+	if format == "png" || format == "gif" {
+		return flateImage(img)
+	}
+	return jpegImage(img, p.config.JPEGQuality())
+}
+
+// jpegImage encodes a processed page as JPEG, single-channel for gray pages
+func jpegImage(img image.Image, quality int) (PDFImage, error) {
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality}); err != nil {
+		return PDFImage{}, fmt.Errorf("failed to encode image: %w", err)
+	}
+
+	components := 3
+	if _, ok := img.(*image.Gray); ok {
+		components = 1
+	}
+	bounds := img.Bounds()
+	return PDFImage{
+		Data:       buf.Bytes(),
+		Width:      bounds.Dx(),
+		Height:     bounds.Dy(),
+		Components: components,
+		Filter:     "DCTDecode",
+	}, nil
+}
+
+// jpegPassthrough returns JPEG data as a PDF image without re-encoding if
+// it is a baseline JPEG in gray or RGB
+func jpegPassthrough(data []byte) (PDFImage, bool) {
+	if !isBaselineJPEG(data) {
+		return PDFImage{}, false
+	}
+
+	cfg, err := jpeg.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return PDFImage{}, false
+	}
+
+	components := 0
+	switch cfg.ColorModel {
+	case color.GrayModel:
+		components = 1
+	case color.YCbCrModel, color.RGBAModel:
+		components = 3
+	default:
+		return PDFImage{}, false
+	}
+
+	return PDFImage{
+		Data:       data,
+		Width:      cfg.Width,
+		Height:     cfg.Height,
+		Components: components,
+		Filter:     "DCTDecode",
+	}, true
+}
+
+// isBaselineJPEG checks the frame marker of JPEG data for a sequential
+// (non-progressive) Huffman-coded frame
+func isBaselineJPEG(data []byte) bool {
+	if len(data) < 4 || data[0] != 0xff || data[1] != 0xd8 {
+		return false
+	}
+
+	pos := 2
+	for pos+4 <= len(data) {
+		if data[pos] != 0xff {
+			return false
+		}
+		marker := data[pos+1]
+		switch {
+		case marker == 0xff:
+			// Fill byte
+			pos++
 			continue
+		case marker == 0xc0 || marker == 0xc1:
+			return true
+		case marker >= 0xc2 && marker <= 0xcf && marker != 0xc4 && marker != 0xc8 && marker != 0xcc:
+			// Progressive, lossless or arithmetic-coded frame
+			return false
+		case marker == 0xd9 || marker == 0xda:
+			// End of image or start of scan before any frame
+			return false
 		}
+		length := int(data[pos+2])<<8 | int(data[pos+3])
+		pos += 2 + length
 	}
+	return false
+}
 
-	// Save PDF
-	if err := pdf.WritePdf(pdfPath); err != nil {
-		return fmt.Errorf("failed to write PDF: %w", err)
+// flateImage stores an image's pixels losslessly with zlib compression.
+// Transparent areas are flattened onto white.
+func flateImage(img image.Image) (PDFImage, error) {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+
+	var pixels []byte
+	components := 3
+	if gray, ok := img.(*image.Gray); ok {
+		components = 1
+		pixels = make([]byte, 0, width*height)
+		for y := 0; y < height; y++ {
+			start := gray.PixOffset(bounds.Min.X, bounds.Min.Y+y)
+			pixels = append(pixels, gray.Pix[start:start+width]...)
+		}
+	} else {
+		rgba := image.NewRGBA(image.Rect(0, 0, width, height))
+		draw.Draw(rgba, rgba.Bounds(), image.White, image.Point{}, draw.Src)
+		draw.Draw(rgba, rgba.Bounds(), img, bounds.Min, draw.Over)
+
+		pixels = make([]byte, 0, width*height*3)
+		for i := 0; i < len(rgba.Pix); i += 4 {
+			pixels = append(pixels, rgba.Pix[i], rgba.Pix[i+1], rgba.Pix[i+2])
+		}
 	}
 
-	return nil
+	var buf bytes.Buffer
+	zw := zlib.NewWriter(&buf)
+	if _, err := zw.Write(pixels); err != nil {
+		return PDFImage{}, err
+	}
+	if err := zw.Close(); err != nil {
+		return PDFImage{}, err
+	}
+
+	return PDFImage{
+		Data:       buf.Bytes(),
+		Width:      width,
+		Height:     height,
+		Components: components,
+		Filter:     "FlateDecode",
+	}, nil
 }
 
 // compressImage compresses image data to JPEG with specified quality
@@ -254,16 +661,57 @@ func (p *PDFGenerator) compressImage(imgData []byte, quality int) ([]byte, error
 }
 
 // normalizeImage converts image to standard RGB color space without quality loss
-// This is used for images that don't need compression but may have color space issues
+// This is used for JPEGs that PDF readers may not display correctly as-is
 func (p *PDFGenerator) normalizeImage(imgData []byte) ([]byte, error) {
 	return p.compressImage(imgData, 100) // Use maximum quality for normalization
 }
 
-// CreatePDFWithTitle creates a PDF with a title page
-func (p *PDFGenerator) CreatePDFWithTitle(comic *Comic, images []DownloadedImage) ([]string, error) {
-	// For now, just use the regular CreatePDF
-	// Title page can be added in future versions
-	return p.CreatePDF(comic, images)
+// CreatePDFWithTitle creates PDFs that each start with a page showing the
+// cover, title, author, tags, page count and album ID
+func (p *PDFGenerator) CreatePDFWithTitle(ctx context.Context, comic *Comic, images []DownloadedImage) ([]string, error) {
+	if len(images) == 0 {
+		return nil, fmt.Errorf("no images to convert")
+	}
+
+	page, err := p.renderTitle(comic, images)
+	if errors.Is(err, errTitleGlyphs) {
+		// A page of missing-glyph boxes is worse than none. The files keep
+		// the title variant so every requester shares this build.
+		p.logf("error", "Skipping the title page of %s: %v", comic.ID, err)
+		return p.CreatePDF(ctx, comic, images)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create title page: %w", err)
+	}
+	p.titlePage = &page
+	defer func() { p.titlePage = nil }()
+
+	return p.CreatePDF(ctx, comic, images)
+}
+
+// Created returns the PDFs written by this generator. PDFs that were
+// already cached are not included.
+func (p *PDFGenerator) Created() []string {
+	return p.created
+}
+
+// skipPage logs a page left out of the PDF and records it as missing
+func (p *PDFGenerator) skipPage(page int, err error) {
+	p.logf("warn", "Skipping page %d: %v", page, err)
+	for _, n := range p.skipped {
+		if n == page {
+			return
+		}
+	}
+	p.skipped = append(p.skipped, page)
+}
+
+// SkippedPages returns the pages left out of the PDFs because they could
+// not be read or encoded, in order
+func (p *PDFGenerator) SkippedPages() []int {
+	pages := append([]int(nil), p.skipped...)
+	sort.Ints(pages)
+	return pages
 }
 
 // CleanupPDF removes generated PDF files
@@ -284,12 +732,17 @@ func (p *PDFGenerator) CleanupPDF(comic *Comic) error {
 	return nil
 }
 
-// encryptPDF encrypts a PDF file with password using AES-256 encryption
-func (p *PDFGenerator) encryptPDF(pdfPath string, password string) error {
-	// Create encryption configuration with AES-256
-	// User password: required to open the PDF
-	// Owner password: same as user password for simplicity
-	conf := model.NewAESConfiguration(password, password, 256)
+// encryptPDF encrypts a PDF file with AES using the configured passwords
+// and permissions
+func (p *PDFGenerator) encryptPDF(pdfPath string) error {
+	// User password: required to open the PDF, may be empty
+	// Owner password: grants full access, the user password if not set
+	ownerPassword := p.config.PDFOwnerPassword
+	if ownerPassword == "" {
+		ownerPassword = p.config.PDFPassword
+	}
+	conf := model.NewAESConfiguration(p.config.PDFPassword, ownerPassword, p.config.PDFKeyLength)
+	conf.Permissions = p.permissions()
 
 	// Relax validation to avoid color space validation errors
 	// This is needed because some images may have non-standard color spaces
@@ -315,3 +768,19 @@ func (p *PDFGenerator) encryptPDF(pdfPath string, password string) error {
 
 	return nil
 }
+
+// permissions returns what readers may do without the owner password
+func (p *PDFGenerator) permissions() model.PermissionFlags {
+	perms := model.PermissionsAll
+	if p.config.PDFNoPrint {
+		perms &^= model.PermissionPrintRev2 | model.PermissionPrintRev3
+	}
+	if p.config.PDFNoCopy {
+		perms &^= model.PermissionExtract | model.PermissionExtractRev3
+	}
+	if p.config.PDFNoModify {
+		perms &^= model.PermissionModify | model.PermissionModAnnFillForm |
+			model.PermissionFillRev3 | model.PermissionAssembleRev3
+	}
+	return perms
+}
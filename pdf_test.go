@@ -0,0 +1,285 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+)
+
+// testPageData encodes a gradient page in the given format
+func testPageData(t testing.TB, width, height int, format string) []byte {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, color.RGBA{uint8(x), uint8(y), uint8(x ^ y), 255})
+		}
+	}
+	var buf bytes.Buffer
+	var err error
+	if format == "png" {
+		err = png.Encode(&buf, img)
+	} else {
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: 90})
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// writeTestAlbum writes n pages alternating between JPEG and PNG files
+func writeTestAlbum(t testing.TB, dir string, n, width, height int) []DownloadedImage {
+	t.Helper()
+	data := map[string][]byte{
+		".jpg": testPageData(t, width, height, "jpeg"),
+		".png": testPageData(t, width, height, "png"),
+	}
+	images := make([]DownloadedImage, n)
+	for i := range images {
+		ext := ".jpg"
+		if i%2 == 1 {
+			ext = ".png"
+		}
+		path := filepath.Join(dir, fmt.Sprintf("%04d%s", i, ext))
+		if err := os.WriteFile(path, data[ext], 0644); err != nil {
+			t.Fatal(err)
+		}
+		images[i] = DownloadedImage{Index: i, Path: path, Size: int64(len(data[ext])), Filename: filepath.Base(path)}
+	}
+	return images
+}
+
+// heapPeak samples the heap until stop is called and returns the highest
+// value seen
+func heapPeak() (stop func() uint64) {
+	var mu sync.Mutex
+	var peak uint64
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		var m runtime.MemStats
+		for {
+			runtime.ReadMemStats(&m)
+			mu.Lock()
+			if m.HeapAlloc > peak {
+				peak = m.HeapAlloc
+			}
+			mu.Unlock()
+			select {
+			case <-done:
+				return
+			case <-time.After(2 * time.Millisecond):
+			}
+		}
+	}()
+	return func() uint64 {
+		close(done)
+		wg.Wait()
+		return peak
+	}
+}
+
+func TestCreatePDFLargeAlbumBoundedMemory(t *testing.T) {
+	if testing.Short() {
+		t.Skip("builds a 300-page album")
+	}
+
+	const (
+		pages  = 300
+		width  = 800
+		height = 1130
+		limit  = 96 << 20 // Far below the ~1GB the decoded album would need
+	)
+	dir := t.TempDir()
+	comic := &Comic{ID: "large"}
+	albumDir := filepath.Join(dir, comic.ID)
+	if err := os.MkdirAll(albumDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	images := writeTestAlbum(t, albumDir, pages, width, height)
+
+	config := DefaultConfig()
+	config.BaseDir = dir
+	config.PDFMaxPages = 0
+
+	runtime.GC()
+	var base runtime.MemStats
+	runtime.ReadMemStats(&base)
+	stop := heapPeak()
+	files, err := NewPDFGenerator(config).CreatePDF(context.Background(), comic, images)
+	peak := stop()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Logf("peak growth %s", formatBytes(int64(peak)-int64(base.HeapAlloc)))
+	if grown := int64(peak) - int64(base.HeapAlloc); grown > limit {
+		t.Errorf("heap grew by %s while building the PDF, want at most %s", formatBytes(grown), formatBytes(limit))
+	}
+	if len(files) != 1 {
+		t.Fatalf("got %d files, want 1", len(files))
+	}
+	if err := api.ValidateFile(files[0], nil); err != nil {
+		t.Fatalf("invalid PDF: %v", err)
+	}
+	if n, err := api.PageCountFile(files[0]); err != nil || n != pages {
+		t.Fatalf("page count %d (%v), want %d", n, err, pages)
+	}
+}
+
+func TestCreatePDFStopsWhenCancelled(t *testing.T) {
+	dir := t.TempDir()
+	comic := &Comic{ID: "cancel"}
+	albumDir := filepath.Join(dir, comic.ID)
+	if err := os.MkdirAll(albumDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	images := writeTestAlbum(t, albumDir, 4, 60, 80)
+
+	config := DefaultConfig()
+	config.BaseDir = dir
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	files, err := NewPDFGenerator(config).CreatePDF(ctx, comic, images)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("got files %v and error %v, want context.Canceled", files, err)
+	}
+	if matches, _ := filepath.Glob(filepath.Join(albumDir, "*.pdf")); len(matches) > 0 {
+		t.Fatalf("cancelled build left %v behind", matches)
+	}
+}
+
+func TestCreatePDFRecordsSkippedPages(t *testing.T) {
+	dir := t.TempDir()
+	comic := &Comic{ID: "skipped"}
+	albumDir := filepath.Join(dir, comic.ID)
+	if err := os.MkdirAll(albumDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	images := writeTestAlbum(t, albumDir, 4, 60, 80)
+	if err := os.WriteFile(images[2].Path, []byte("not an image"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	config := DefaultConfig()
+	config.BaseDir = dir
+	gen := NewPDFGenerator(config)
+	var logged []string
+	gen.SetLogger(func(level, message string) {
+		logged = append(logged, level+": "+message)
+	})
+	files, err := gen.CreatePDF(context.Background(), comic, images)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, err := api.PageCountFile(files[0]); err != nil || n != 3 {
+		t.Fatalf("page count %d (%v), want 3", n, err)
+	}
+	if got := gen.SkippedPages(); len(got) != 1 || got[0] != 3 {
+		t.Errorf("skipped pages %v, want [3]", got)
+	}
+	if len(logged) != 1 || !strings.HasPrefix(logged[0], "warn: Skipping page 3") {
+		t.Errorf("logged %q, want one warning for page 3", logged)
+	}
+}
+
+func TestCreatePDFBookmarksFollowLayout(t *testing.T) {
+	tests := []struct {
+		name     string
+		setup    func(*ImageProcessing)
+		chapters [][]image.Image
+		want     []int // First PDF page of each chapter
+	}{
+		{
+			// The first chapter leaves 65 rows in the strip, more than a
+			// 60-row page, so the second chapter starts on PDF page 2
+			name:     "long strip",
+			setup:    func(s *ImageProcessing) { s.LongStrip = LongStripOn; s.StripPageRatio = 1 },
+			chapters: [][]image.Image{{solidPage(60, 65, red)}, {solidPage(60, 100, blue), solidPage(60, 100, red)}},
+			want:     []int{1, 2},
+		},
+		{
+			// The cover is single and pages 2 and 3 share one spread
+			name:     "merged spreads",
+			setup:    func(s *ImageProcessing) { s.Spreads = SpreadsMerge },
+			chapters: [][]image.Image{{solidPage(60, 100, red), solidPage(60, 100, red)}, {solidPage(60, 100, blue), solidPage(60, 100, blue)}},
+			want:     []int{1, 2},
+		},
+		{
+			name:     "split spreads",
+			setup:    func(s *ImageProcessing) { s.Spreads = SpreadsSplit },
+			chapters: [][]image.Image{{solidPage(160, 100, red)}, {solidPage(160, 100, blue)}},
+			want:     []int{1, 3},
+		},
+	}
+
+	for _, tc := range tests {
+		dir := t.TempDir()
+		comic := &Comic{ID: "bookmarks"}
+		albumDir := filepath.Join(dir, comic.ID)
+		if err := os.MkdirAll(albumDir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		var images []DownloadedImage
+		for c, pages := range tc.chapters {
+			chapter := Chapter{Title: fmt.Sprintf("第%d话", c+1)}
+			for _, page := range pages {
+				var buf bytes.Buffer
+				if err := png.Encode(&buf, page); err != nil {
+					t.Fatal(err)
+				}
+				path := filepath.Join(albumDir, fmt.Sprintf("%04d.png", len(images)))
+				if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+					t.Fatal(err)
+				}
+				chapter.ImageURLs = append(chapter.ImageURLs, path)
+				images = append(images, DownloadedImage{Index: len(images), Path: path, Size: int64(buf.Len())})
+			}
+			comic.Chapters = append(comic.Chapters, chapter)
+		}
+
+		config := DefaultConfig()
+		config.BaseDir = dir
+		tc.setup(&config.Processing)
+		files, err := NewPDFGenerator(config).CreatePDF(context.Background(), comic, images)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+
+		f, err := os.Open(files[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		bookmarks, err := api.Bookmarks(f, nil)
+		f.Close()
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		if len(bookmarks) != len(tc.want) {
+			t.Fatalf("%s: got %d bookmarks, want %d", tc.name, len(bookmarks), len(tc.want))
+		}
+		for i, b := range bookmarks {
+			if b.PageFrom != tc.want[i] {
+				t.Errorf("%s: %q on page %d, want page %d", tc.name, b.Title, b.PageFrom, tc.want[i])
+			}
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// pdfCreator is the application name written into PDF metadata
+const pdfCreator = "showmejm"
+
+// PDFInfo is the document metadata written into the Info dictionary and
+// the XMP metadata stream
+type PDFInfo struct {
+	Title    string
+	Author   string
+	Subject  string
+	Keywords []string
+	Creator  string
+	AlbumID  string
+	Source   string // Album page URL
+	Created  time.Time
+}
+
+// documentInfo returns the metadata for an album's PDFs
+func documentInfo(comic *Comic) PDFInfo {
+	info := PDFInfo{
+		Title:    comic.Title,
+		Author:   comic.Author,
+		Subject:  strings.TrimSpace(comic.Description),
+		Keywords: comic.Tags,
+		Creator:  pdfCreator,
+		AlbumID:  comic.ID,
+		Source:   comic.URL,
+		Created:  time.Now(),
+	}
+	if info.Title == "" {
+		info.Title = "JM" + comic.ID
+	}
+	if info.Subject == "" {
+		info.Subject = "JM" + comic.ID
+	}
+	return info
+}
+
+// infoDict returns the body of the document Info dictionary
+func (i PDFInfo) infoDict() string {
+	var b strings.Builder
+	entry := func(key, value string) {
+		if value != "" {
+			fmt.Fprintf(&b, "/%s %s ", key, pdfTextString(value))
+		}
+	}
+	entry("Title", i.Title)
+	entry("Author", i.Author)
+	entry("Subject", i.Subject)
+	entry("Keywords", strings.Join(i.Keywords, ", "))
+	entry("Creator", i.Creator)
+	entry("Producer", i.Creator)
+	entry("AlbumID", i.AlbumID)
+	entry("Source", i.Source)
+	if !i.Created.IsZero() {
+		fmt.Fprintf(&b, "/CreationDate (%s) ", pdfDate(i.Created))
+	}
+	return "<< " + b.String() + ">>"
+}
+
+// xmp returns the XMP metadata packet with the same fields as the Info
+// dictionary
+func (i PDFInfo) xmp() []byte {
+	var b strings.Builder
+	b.WriteString("<?xpacket begin=\"\xef\xbb\xbf\" id=\"W5M0MpCehiHzreSzNTczkc9d\"?>\n")
+	b.WriteString("<x:xmpmeta xmlns:x=\"adobe:ns:meta/\">\n")
+	b.WriteString("<rdf:RDF xmlns:rdf=\"http://www.w3.org/1999/02/22-rdf-syntax-ns#\">\n")
+	b.WriteString("<rdf:Description rdf:about=\"\"" +
+		" xmlns:dc=\"http://purl.org/dc/elements/1.1/\"" +
+		" xmlns:xmp=\"http://ns.adobe.com/xap/1.0/\"" +
+		" xmlns:pdf=\"http://ns.adobe.com/pdf/1.3/\">\n")
+
+	element := func(name, value string) {
+		if value != "" {
+			fmt.Fprintf(&b, "<%s>%s</%s>\n", name, xmlEscape(value), name)
+		}
+	}
+	alt := func(name, value string) {
+		if value != "" {
+			fmt.Fprintf(&b, "<%s><rdf:Alt><rdf:li xml:lang=\"x-default\">%s</rdf:li></rdf:Alt></%s>\n",
+				name, xmlEscape(value), name)
+		}
+	}
+	list := func(name, kind string, values []string) {
+		if len(values) == 0 {
+			return
+		}
+		fmt.Fprintf(&b, "<%s><rdf:%s>", name, kind)
+		for _, v := range values {
+			fmt.Fprintf(&b, "<rdf:li>%s</rdf:li>", xmlEscape(v))
+		}
+		fmt.Fprintf(&b, "</rdf:%s></%s>\n", kind, name)
+	}
+
+	element("dc:format", "application/pdf")
+	alt("dc:title", i.Title)
+	if i.Author != "" {
+		list("dc:creator", "Seq", []string{i.Author})
+	}
+	alt("dc:description", i.Subject)
+	list("dc:subject", "Bag", i.Keywords)
+	element("dc:identifier", i.AlbumID)
+	element("dc:source", i.Source)
+	element("pdf:Keywords", strings.Join(i.Keywords, ", "))
+	element("pdf:Producer", i.Creator)
+	element("xmp:CreatorTool", i.Creator)
+	if !i.Created.IsZero() {
+		element("xmp:CreateDate", i.Created.Format(time.RFC3339))
+	}
+
+	b.WriteString("</rdf:Description>\n</rdf:RDF>\n</x:xmpmeta>\n")
+	b.WriteString("<?xpacket end=\"w\"?>")
+	return []byte(b.String())
+}
+
+// pdfDate formats a time as a PDF date string
+func pdfDate(t time.Time) string {
+	return t.Format("D:20060102150405-07'00'")
+}
+
+// xmlEscape escapes text for use in XML content
+func xmlEscape(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
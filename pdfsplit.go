@@ -0,0 +1,174 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// pdfPart is a range of images that goes into one PDF file
+type pdfPart struct {
+	start  int // Index of the first image in the album's images
+	images []DownloadedImage
+	label  string // File name suffix, empty for an album in a single file
+}
+
+// splitParts divides the images into PDF files according to the split
+// strategy. Albums with a single chapter are split by pages in chapter mode.
+// Part labels start with the split key, so parts cut with other settings
+// are not mistaken for these.
+func (p *PDFGenerator) splitParts(images []DownloadedImage) []pdfPart {
+	var parts []pdfPart
+	var key string
+	switch {
+	case p.config.PDFSplit == PDFSplitChapter && p.chapters != nil:
+		parts = p.chapterParts(images)
+		key = "ch"
+		if p.config.PDFGroupChapters {
+			key += "g"
+		}
+		if p.config.PDFMaxPages > 0 {
+			key += fmt.Sprintf("%dp", p.config.PDFMaxPages)
+		}
+		if p.config.PDFMaxSizeMB > 0 {
+			key += fmt.Sprintf("%dmb", p.config.PDFMaxSizeMB)
+		}
+	case p.config.PDFSplit == PDFSplitSize:
+		parts = limitParts(images, 0, len(images), 0, p.maxPartBytes())
+		key = fmt.Sprintf("%dmb", p.config.PDFMaxSizeMB)
+	default:
+		parts = limitParts(images, 0, len(images), p.config.PDFMaxPages, 0)
+		key = fmt.Sprintf("%dp", p.config.PDFMaxPages)
+	}
+
+	if len(parts) == 1 {
+		parts[0].label = ""
+		return parts
+	}
+	for i := range parts {
+		if parts[i].label == "" {
+			parts[i].label = fmt.Sprintf("part%d", i+1)
+		}
+		parts[i].label = key + "-" + parts[i].label
+	}
+	return parts
+}
+
+// maxPartBytes returns the image bytes allowed per file, 0 for no limit
+func (p *PDFGenerator) maxPartBytes() int64 {
+	return int64(p.config.PDFMaxSizeMB) << 20
+}
+
+// limitParts cuts images[start:end] into parts of at most maxPages pages
+// and maxBytes of image data. A zero limit is not applied. Every part has
+// at least one image, so a single image over the size limit gets its own
+// file.
+func limitParts(images []DownloadedImage, start, end, maxPages int, maxBytes int64) []pdfPart {
+	parts := make([]pdfPart, 0, 1)
+	first := start
+	var size int64
+	for i := start; i < end; i++ {
+		pages := i - first
+		full := (maxPages > 0 && pages >= maxPages) ||
+			(maxBytes > 0 && pages > 0 && size+images[i].Size > maxBytes)
+		if full {
+			parts = append(parts, pdfPart{start: first, images: images[first:i]})
+			first, size = i, 0
+		}
+		size += images[i].Size
+	}
+	if first < end {
+		parts = append(parts, pdfPart{start: first, images: images[first:end]})
+	}
+	return parts
+}
+
+// chapterRun is a stretch of images belonging to one chapter
+type chapterRun struct {
+	chapter    int
+	start, end int
+	size       int64
+}
+
+// chapterParts puts each chapter in its own file, or groups consecutive
+// chapters while they stay within the page and size limits. A chapter over
+// the limits is split into several files.
+func (p *PDFGenerator) chapterParts(images []DownloadedImage) []pdfPart {
+	runs := make([]chapterRun, 0, len(p.chapters))
+	for i, img := range images {
+		c := p.chapterOf(img.Index)
+		if len(runs) == 0 || runs[len(runs)-1].chapter != c {
+			runs = append(runs, chapterRun{chapter: c, start: i, end: i})
+		}
+		runs[len(runs)-1].end = i + 1
+		runs[len(runs)-1].size += img.Size
+	}
+
+	maxPages, maxBytes := p.config.PDFMaxPages, p.maxPartBytes()
+	fits := func(pages int, size int64) bool {
+		return (maxPages <= 0 || pages <= maxPages) && (maxBytes <= 0 || size <= maxBytes)
+	}
+
+	parts := make([]pdfPart, 0, len(runs))
+	var group []chapterRun
+	var groupSize int64
+	flush := func() {
+		if len(group) == 0 {
+			return
+		}
+		first, last := group[0], group[len(group)-1]
+		parts = append(parts, pdfPart{
+			start:  first.start,
+			images: images[first.start:last.end],
+			label:  chapterLabel(first.chapter, last.chapter),
+		})
+		group, groupSize = nil, 0
+	}
+
+	for _, run := range runs {
+		if !fits(run.end-run.start, run.size) {
+			flush()
+			pieces := limitParts(images, run.start, run.end, maxPages, maxBytes)
+			for i := range pieces {
+				pieces[i].label = fmt.Sprintf("%s-part%d", chapterLabel(run.chapter, run.chapter), i+1)
+			}
+			parts = append(parts, pieces...)
+			continue
+		}
+
+		if len(group) > 0 {
+			pages := run.end - group[0].start
+			if !p.config.PDFGroupChapters || !fits(pages, groupSize+run.size) {
+				flush()
+			}
+		}
+		group = append(group, run)
+		groupSize += run.size
+	}
+	flush()
+	return parts
+}
+
+// chapterLabel names a part after the 1-based chapter numbers it contains
+func chapterLabel(first, last int) string {
+	if first == last {
+		return fmt.Sprintf("ch%d", first+1)
+	}
+	return fmt.Sprintf("ch%d-%d", first+1, last+1)
+}
+
+// UploadName returns the file name to upload a generated PDF as: the album
+// ID, followed by the part number or the chapters it contains
+func (p *PDFGenerator) UploadName(comic *Comic, pdfPath string) string {
+	label := strings.TrimPrefix(filepath.Base(pdfPath), comic.ID)
+	label = strings.TrimSuffix(label, p.Variant()+".pdf")
+	label = strings.TrimPrefix(label, "-")
+	if label == "" {
+		return comic.ID + ".pdf"
+	}
+	// Drop the split key
+	if _, rest, ok := strings.Cut(label, "-"); ok {
+		label = rest
+	}
+	return fmt.Sprintf("%s-%s.pdf", comic.ID, strings.TrimPrefix(label, "part"))
+}
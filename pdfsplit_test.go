@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSplitPartsNameFilesAfterTheirSettings(t *testing.T) {
+	dir := t.TempDir()
+	comic := &Comic{ID: "300", Chapters: []Chapter{
+		{Title: "1", ImageURLs: make([]string, 2)},
+		{Title: "2", ImageURLs: make([]string, 2)},
+		{Title: "3", ImageURLs: make([]string, 2)},
+	}}
+	albumDir := filepath.Join(dir, comic.ID)
+	if err := os.MkdirAll(albumDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	images := writeTestAlbum(t, albumDir, 6, 40, 60)
+
+	tests := []struct {
+		name    string
+		split   string
+		pages   int
+		group   bool
+		uploads []string
+	}{
+		{"4 pages", PDFSplitPages, 4, false, []string{"300-1.pdf", "300-2.pdf"}},
+		{"3 pages", PDFSplitPages, 3, false, []string{"300-1.pdf", "300-2.pdf"}},
+		{"chapters", PDFSplitChapter, 0, false, []string{"300-ch1.pdf", "300-ch2.pdf", "300-ch3.pdf"}},
+		{"grouped chapters", PDFSplitChapter, 4, true, []string{"300-ch1-2.pdf", "300-ch3.pdf"}},
+	}
+
+	seen := make(map[string]string)
+	for _, tc := range tests {
+		config := DefaultConfig()
+		config.BaseDir = dir
+		config.PDFSplit = tc.split
+		config.PDFMaxPages = tc.pages
+		config.PDFGroupChapters = tc.group
+		gen := NewPDFGenerator(config)
+
+		files, err := gen.CreatePDF(context.Background(), comic, images)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		if len(files) != len(tc.uploads) {
+			t.Fatalf("%s: got %d files, want %d", tc.name, len(files), len(tc.uploads))
+		}
+		for i, file := range files {
+			// Each setting must build its own files rather than reuse
+			// parts cut differently
+			if other, ok := seen[file]; ok {
+				t.Errorf("%s: %s was already built for %s", tc.name, filepath.Base(file), other)
+			}
+			seen[file] = tc.name
+
+			if name := gen.UploadName(comic, file); name != tc.uploads[i] {
+				t.Errorf("%s: %s uploads as %s, want %s", tc.name, filepath.Base(file), name, tc.uploads[i])
+			}
+		}
+	}
+}
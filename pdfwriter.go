@@ -0,0 +1,311 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode/utf16"
+)
+
+// PDFWriter writes a PDF incrementally, one page at a time, so only the
+// page being written has to be held in memory
+type PDFWriter struct {
+	file    *os.File
+	w       *bufio.Writer
+	offset  int64
+	offsets []int64 // Byte offset of each object, indexed by object number - 1
+	pages   []int   // Object numbers of the page objects
+	outline []pdfBookmark
+	info    *PDFInfo
+	prefs   string // Viewer preference entries of the catalog
+}
+
+// pdfBookmark is a top-level outline entry pointing at a page
+type pdfBookmark struct {
+	title string
+	page  int // Zero-based page index
+}
+
+// PDF object numbers reserved for the document structure
+const (
+	pdfCatalogObj = 1
+	pdfPagesObj   = 2
+)
+
+// NewPDFWriter creates a PDF file at path and writes the header
+func NewPDFWriter(path string) (*PDFWriter, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+
+	w := &PDFWriter{
+		file:    file,
+		w:       bufio.NewWriterSize(file, 256*1024),
+		offsets: make([]int64, 2),
+	}
+
+	// Binary comment marks the file as containing binary data
+	if err := w.writeString("%PDF-1.7\n%\xe2\xe3\xcf\xd3\n"); err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	return w, nil
+}
+
+// PageCount returns the number of pages written so far
+func (w *PDFWriter) PageCount() int {
+	return len(w.pages)
+}
+
+// PDFImage is image data ready to be embedded in a PDF
+type PDFImage struct {
+	Data       []byte
+	Width      int
+	Height     int
+	Components int    // 1 for gray, 3 for RGB
+	Filter     string // "DCTDecode" for JPEG data, "FlateDecode" for zlib-compressed pixels
+	Sources    []int  // Album page numbers shown on this page, used to place bookmarks
+}
+
+// AddBookmark adds an outline entry for the page at index page. Entries
+// are kept in the order they are added.
+func (w *PDFWriter) AddBookmark(title string, page int) {
+	w.outline = append(w.outline, pdfBookmark{title: title, page: page})
+}
+
+// SetInfo sets the document metadata written when the file is closed
+func (w *PDFWriter) SetInfo(info PDFInfo) {
+	w.info = &info
+}
+
+// SetViewerPreferences sets the reading direction viewers page in and
+// whether they open the document as facing pages, with the first page on
+// its own like a book cover
+func (w *PDFWriter) SetViewerPreferences(rightToLeft, twoPage bool) {
+	w.prefs = ""
+	if rightToLeft {
+		w.prefs += " /ViewerPreferences << /Direction /R2L >>"
+	}
+	if twoPage {
+		w.prefs += " /PageLayout /TwoPageRight"
+	}
+}
+
+// AddImagePage adds a page showing an image scaled to pageWidth x pageHeight
+func (w *PDFWriter) AddImagePage(img PDFImage, pageWidth, pageHeight float64) error {
+	colorSpace := "/DeviceRGB"
+	switch img.Components {
+	case 1:
+		colorSpace = "/DeviceGray"
+	case 3:
+	default:
+		return fmt.Errorf("unsupported image component count %d", img.Components)
+	}
+
+	imageObj, err := w.writeStream(
+		fmt.Sprintf("/Type /XObject /Subtype /Image /Width %d /Height %d /ColorSpace %s /BitsPerComponent 8 /Filter /%s",
+			img.Width, img.Height, colorSpace, img.Filter),
+		img.Data)
+	if err != nil {
+		return err
+	}
+
+	return w.addImagePage(imageObj, pageWidth, pageHeight)
+}
+
+// addImagePage adds a page that draws an image XObject over the whole page
+func (w *PDFWriter) addImagePage(imageObj int, pageWidth, pageHeight float64) error {
+	content := fmt.Sprintf("q %.2f 0 0 %.2f 0 0 cm /Im0 Do Q", pageWidth, pageHeight)
+	contentObj, err := w.writeStream("", []byte(content))
+	if err != nil {
+		return err
+	}
+
+	pageObj, err := w.writeObject(fmt.Sprintf(
+		"<< /Type /Page /Parent %d 0 R /MediaBox [0 0 %.2f %.2f] /Resources << /XObject << /Im0 %d 0 R >> >> /Contents %d 0 R >>",
+		pdfPagesObj, pageWidth, pageHeight, imageObj, contentObj))
+	if err != nil {
+		return err
+	}
+
+	w.pages = append(w.pages, pageObj)
+	return nil
+}
+
+// Close writes the page tree, catalog and cross-reference table and closes the file
+func (w *PDFWriter) Close() error {
+	if err := w.finish(); err != nil {
+		w.file.Close()
+		return err
+	}
+	return w.file.Close()
+}
+
+// Abort closes the file and removes it
+func (w *PDFWriter) Abort() {
+	w.file.Close()
+	os.Remove(w.file.Name())
+}
+
+// finish writes the document structure and trailer
+func (w *PDFWriter) finish() error {
+	if len(w.pages) == 0 {
+		return fmt.Errorf("PDF has no pages")
+	}
+
+	kids := ""
+	for i, obj := range w.pages {
+		if i > 0 {
+			kids += " "
+		}
+		kids += fmt.Sprintf("%d 0 R", obj)
+	}
+	if err := w.writeObjectAt(pdfPagesObj, fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", kids, len(w.pages))); err != nil {
+		return err
+	}
+
+	catalog := fmt.Sprintf("/Type /Catalog /Pages %d 0 R", pdfPagesObj) + w.prefs
+	if len(w.outline) > 0 {
+		outlineObj, err := w.writeOutline()
+		if err != nil {
+			return err
+		}
+		catalog += fmt.Sprintf(" /Outlines %d 0 R /PageMode /UseOutlines", outlineObj)
+	}
+	infoRef := ""
+	if w.info != nil {
+		metadataObj, err := w.writeStream("/Type /Metadata /Subtype /XML", w.info.xmp())
+		if err != nil {
+			return err
+		}
+		catalog += fmt.Sprintf(" /Metadata %d 0 R", metadataObj)
+
+		infoObj, err := w.writeObject(w.info.infoDict())
+		if err != nil {
+			return err
+		}
+		infoRef = fmt.Sprintf(" /Info %d 0 R", infoObj)
+	}
+	if err := w.writeObjectAt(pdfCatalogObj, "<< "+catalog+" >>"); err != nil {
+		return err
+	}
+
+	// Cross-reference table
+	xrefOffset := w.offset
+	if err := w.writeString(fmt.Sprintf("xref\n0 %d\n0000000000 65535 f \n", len(w.offsets)+1)); err != nil {
+		return err
+	}
+	for _, off := range w.offsets {
+		if err := w.writeString(fmt.Sprintf("%010d 00000 n \n", off)); err != nil {
+			return err
+		}
+	}
+
+	trailer := fmt.Sprintf("trailer\n<< /Size %d /Root %d 0 R%s >>\nstartxref\n%d\n%%%%EOF\n",
+		len(w.offsets)+1, pdfCatalogObj, infoRef, xrefOffset)
+	if err := w.writeString(trailer); err != nil {
+		return err
+	}
+
+	return w.w.Flush()
+}
+
+// writeOutline writes the outline root and its entries and returns the
+// root's object number
+func (w *PDFWriter) writeOutline() (int, error) {
+	root := w.reserveObjects(len(w.outline) + 1)
+	first, last := root+1, root+len(w.outline)
+
+	for i, bookmark := range w.outline {
+		num := root + 1 + i
+		page := bookmark.page
+		if page >= len(w.pages) {
+			page = len(w.pages) - 1
+		}
+
+		body := fmt.Sprintf("/Title %s /Parent %d 0 R /Dest [%d 0 R /Fit]",
+			pdfTextString(bookmark.title), root, w.pages[page])
+		if num > first {
+			body += fmt.Sprintf(" /Prev %d 0 R", num-1)
+		}
+		if num < last {
+			body += fmt.Sprintf(" /Next %d 0 R", num+1)
+		}
+		if err := w.writeObjectAt(num, "<< "+body+" >>"); err != nil {
+			return 0, err
+		}
+	}
+
+	err := w.writeObjectAt(root, fmt.Sprintf("<< /Type /Outlines /First %d 0 R /Last %d 0 R /Count %d >>",
+		first, last, len(w.outline)))
+	return root, err
+}
+
+// pdfTextString encodes text as a UTF-16BE hex string so any script
+// displays correctly
+func pdfTextString(text string) string {
+	var b strings.Builder
+	b.WriteString("<FEFF")
+	for _, u := range utf16.Encode([]rune(text)) {
+		fmt.Fprintf(&b, "%04X", u)
+	}
+	b.WriteString(">")
+	return b.String()
+}
+
+// reserveObjects reserves n consecutive object numbers and returns the first
+func (w *PDFWriter) reserveObjects(n int) int {
+	first := len(w.offsets) + 1
+	w.offsets = append(w.offsets, make([]int64, n)...)
+	return first
+}
+
+// writeObject writes a new object and returns its object number
+func (w *PDFWriter) writeObject(body string) (int, error) {
+	w.offsets = append(w.offsets, 0)
+	num := len(w.offsets)
+	return num, w.writeObjectAt(num, body)
+}
+
+// writeObjectAt writes an object with a previously reserved number
+func (w *PDFWriter) writeObjectAt(num int, body string) error {
+	w.offsets[num-1] = w.offset
+	return w.writeString(fmt.Sprintf("%d 0 obj\n%s\nendobj\n", num, body))
+}
+
+// writeStream writes a stream object with the given extra dictionary entries
+func (w *PDFWriter) writeStream(dict string, data []byte) (int, error) {
+	w.offsets = append(w.offsets, w.offset)
+	num := len(w.offsets)
+
+	header := fmt.Sprintf("%d 0 obj\n<< %s /Length %d >>\nstream\n", num, dict, len(data))
+	if err := w.writeString(header); err != nil {
+		return 0, err
+	}
+	if err := w.write(data); err != nil {
+		return 0, err
+	}
+	if err := w.writeString("\nendstream\nendobj\n"); err != nil {
+		return 0, err
+	}
+
+	return num, nil
+}
+
+// writeString writes a string and tracks the file offset
+func (w *PDFWriter) writeString(s string) error {
+	n, err := io.WriteString(w.w, s)
+	w.offset += int64(n)
+	return err
+}
+
+// write writes bytes and tracks the file offset
+func (w *PDFWriter) write(data []byte) error {
+	n, err := w.w.Write(data)
+	w.offset += int64(n)
+	return err
+}
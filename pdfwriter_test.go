@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+)
+
+// testJPEGPage returns a page as embedded JPEG data
+func testJPEGPage(t testing.TB, width, height int) PDFImage {
+	t.Helper()
+	img := image.NewGray(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.SetGray(x, y, color.Gray{Y: uint8(x + y)})
+		}
+	}
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, nil); err != nil {
+		t.Fatal(err)
+	}
+	return PDFImage{Data: buf.Bytes(), Width: width, Height: height, Components: 1, Filter: "DCTDecode"}
+}
+
+func TestPDFWriterPagesOutlineAndInfo(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out.pdf")
+	w, err := NewPDFWriter(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rgb := image.NewRGBA(image.Rect(0, 0, 40, 30))
+	for i := range rgb.Pix {
+		rgb.Pix[i] = uint8(i)
+	}
+	flate, err := flateImage(rgb)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w.SetInfo(PDFInfo{Title: "标题 <&>", Author: "作者", Keywords: []string{"a", "b"}, Creator: pdfCreator, AlbumID: "123"})
+	w.SetViewerPreferences(true, true)
+	w.AddBookmark("第1话", 0)
+	if err := w.AddImagePage(testJPEGPage(t, 60, 80), 600, 800); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.AddImagePage(flate, 800, 600); err != nil {
+		t.Fatal(err)
+	}
+	w.AddBookmark("第2话 标题", w.PageCount())
+	if err := w.AddImagePage(testJPEGPage(t, 60, 80), 600, 800); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := api.ValidateFile(path, nil); err != nil {
+		t.Fatalf("invalid PDF: %v", err)
+	}
+	if n, err := api.PageCountFile(path); err != nil || n != 3 {
+		t.Fatalf("page count %d (%v), want 3", n, err)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	bookmarks, err := api.Bookmarks(f, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []struct {
+		title string
+		page  int
+	}{{"第1话", 1}, {"第2话 标题", 3}}
+	if len(bookmarks) != len(want) {
+		t.Fatalf("got %d bookmarks, want %d", len(bookmarks), len(want))
+	}
+	for i, b := range bookmarks {
+		if b.Title != want[i].title || b.PageFrom != want[i].page {
+			t.Errorf("bookmark %d = %q on page %d, want %q on page %d", i, b.Title, b.PageFrom, want[i].title, want[i].page)
+		}
+	}
+
+	if _, err := f.Seek(0, 0); err != nil {
+		t.Fatal(err)
+	}
+	info, err := api.PDFInfo(f, path, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Title != "标题 <&>" || info.Author != "作者" || info.Properties["AlbumID"] != "123" {
+		t.Errorf("info = %q by %q, album %q", info.Title, info.Author, info.Properties["AlbumID"])
+	}
+	if info.PageLayout != "TwoPageRight" {
+		t.Errorf("page layout %q, want TwoPageRight", info.PageLayout)
+	}
+}
+
+func TestPDFWriterRejectsEmptyDocument(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "empty.pdf")
+	w, err := NewPDFWriter(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err == nil {
+		t.Fatal("Close succeeded without pages")
+	}
+}
+
+func TestPDFWriterAbortRemovesFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "aborted.pdf")
+	w, err := NewPDFWriter(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.AddImagePage(testJPEGPage(t, 10, 10), 100, 100); err != nil {
+		t.Fatal(err)
+	}
+	w.Abort()
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("file still exists after Abort: %v", err)
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"os"
+
+	xdraw "golang.org/x/image/draw"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
+)
+
+// placeholderExt marks generated placeholder pages so they are never
+// mistaken for cached downloads
+const placeholderExt = ".missing.jpg"
+
+// Placeholder page size, roughly A4 portrait
+const (
+	placeholderWidth  = 1240
+	placeholderHeight = 1754
+	placeholderScale  = 6 // Upscale factor for the 7x13 bitmap font
+)
+
+// createPlaceholder renders a "page N missing" page, saves it to path and
+// returns the file size
+func createPlaceholder(path string, pageNum int) (int64, error) {
+	text := fmt.Sprintf("Page %d missing", pageNum)
+
+	// Draw the text with the bitmap font on a small canvas
+	face := basicfont.Face7x13
+	textWidth := font.MeasureString(face, text).Ceil()
+	small := image.NewRGBA(image.Rect(0, 0, textWidth+4, face.Height+4))
+	for i := range small.Pix {
+		small.Pix[i] = 0xff
+	}
+	drawer := &font.Drawer{
+		Dst:  small,
+		Src:  image.NewUniform(color.Gray{Y: 0x60}),
+		Face: face,
+		Dot:  fixed.P(2, face.Ascent+2),
+	}
+	drawer.DrawString(text)
+
+	// Scale it up and center it on a white page
+	page := image.NewRGBA(image.Rect(0, 0, placeholderWidth, placeholderHeight))
+	for i := range page.Pix {
+		page.Pix[i] = 0xff
+	}
+	w := small.Bounds().Dx() * placeholderScale
+	h := small.Bounds().Dy() * placeholderScale
+	x := (placeholderWidth - w) / 2
+	y := (placeholderHeight - h) / 2
+	xdraw.NearestNeighbor.Scale(page, image.Rect(x, y, x+w, y+h), small, small.Bounds(), xdraw.Src, nil)
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, page, &jpeg.Options{Quality: 90}); err != nil {
+		return 0, err
+	}
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		return 0, err
+	}
+
+	return int64(buf.Len()), nil
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"sync"
+)
+
+// DownloadPool is a plugin-wide worker pool shared by all download jobs.
+// Workers serve the highest priority jobs first and pick tasks from jobs of
+// equal priority in round-robin order so that a large album cannot starve a
+// small one that was queued after it.
+type DownloadPool struct {
+	mu     sync.Mutex
+	cond   *sync.Cond
+	jobs   []*PoolJob
+	next   int
+	closed bool
+	wg     sync.WaitGroup
+	memory *MemoryBudget
+}
+
+// PoolJob is a group of tasks submitted to the pool by one download
+type PoolJob struct {
+	pool     *DownloadPool
+	tasks    []func()
+	inflight int
+	limit    int
+	priority int
+	wg       sync.WaitGroup
+}
+
+// NewDownloadPool creates a pool with the given number of workers whose
+// tasks share a memory budget of memoryLimit bytes (0 means no limit)
+func NewDownloadPool(workers int, memoryLimit int64) *DownloadPool {
+	if workers <= 0 {
+		workers = 10
+	}
+
+	pool := &DownloadPool{
+		memory: NewMemoryBudget(memoryLimit),
+	}
+	pool.cond = sync.NewCond(&pool.mu)
+
+	for i := 0; i < workers; i++ {
+		pool.wg.Add(1)
+		go pool.worker()
+	}
+
+	return pool
+}
+
+// NewJob registers a new job with the pool.
+// limit caps how many of the job's tasks may run at once (0 means no cap).
+func (p *DownloadPool) NewJob(limit int, priority int) *PoolJob {
+	job := &PoolJob{
+		pool:     p,
+		limit:    limit,
+		priority: priority,
+	}
+
+	p.mu.Lock()
+	p.jobs = append(p.jobs, job)
+	p.mu.Unlock()
+
+	return job
+}
+
+// Memory returns the memory budget shared by the pool's tasks
+func (p *DownloadPool) Memory() *MemoryBudget {
+	return p.memory
+}
+
+// Close stops all workers after the queued tasks are finished
+func (p *DownloadPool) Close() {
+	p.mu.Lock()
+	p.closed = true
+	p.cond.Broadcast()
+	p.mu.Unlock()
+
+	p.wg.Wait()
+}
+
+// worker runs tasks until the pool is closed
+func (p *DownloadPool) worker() {
+	defer p.wg.Done()
+
+	for {
+		p.mu.Lock()
+		job, task := p.nextTask()
+		for task == nil {
+			if p.closed {
+				p.mu.Unlock()
+				return
+			}
+			p.cond.Wait()
+			job, task = p.nextTask()
+		}
+		job.inflight++
+		p.mu.Unlock()
+
+		task()
+
+		p.mu.Lock()
+		job.inflight--
+		p.cond.Broadcast()
+		p.mu.Unlock()
+		job.wg.Done()
+	}
+}
+
+// nextTask picks the next runnable task from the highest priority jobs,
+// in round-robin order among jobs of equal priority.
+// Must be called with p.mu held.
+func (p *DownloadPool) nextTask() (*PoolJob, func()) {
+	best := -1
+	for i := 0; i < len(p.jobs); i++ {
+		idx := (p.next + i) % len(p.jobs)
+		job := p.jobs[idx]
+		if len(job.tasks) == 0 {
+			continue
+		}
+		if job.limit > 0 && job.inflight >= job.limit {
+			continue
+		}
+		if best < 0 || job.priority > p.jobs[best].priority {
+			best = idx
+		}
+	}
+	if best < 0 {
+		return nil, nil
+	}
+
+	job := p.jobs[best]
+	task := job.tasks[0]
+	job.tasks = job.tasks[1:]
+	p.next = best + 1
+	return job, task
+}
+
+// Submit queues a task for this job
+func (j *PoolJob) Submit(task func()) {
+	j.wg.Add(1)
+
+	j.pool.mu.Lock()
+	j.tasks = append(j.tasks, task)
+	j.pool.cond.Signal()
+	j.pool.mu.Unlock()
+}
+
+// Wait blocks until all submitted tasks have finished
+func (j *PoolJob) Wait() {
+	j.wg.Wait()
+}
+
+// Close unregisters the job from the pool
+func (j *PoolJob) Close() {
+	p := j.pool
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for i, job := range p.jobs {
+		if job == j {
+			p.jobs = append(p.jobs[:i], p.jobs[i+1:]...)
+			if p.next > i {
+				p.next--
+			}
+			break
+		}
+	}
+}
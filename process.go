@@ -0,0 +1,214 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+
+	xdraw "golang.org/x/image/draw"
+)
+
+// Tolerances used when looking for borders and color
+const (
+	borderTolerance = 16 // Max channel difference from the border color
+	borderWhite     = 235
+	borderBlack     = 20
+	grayTolerance   = 6 // Max chroma difference for a pixel to count as gray
+)
+
+// processImage applies the configured processing to a page and reports
+// whether the image was changed
+func processImage(img image.Image, s ImageProcessing) (image.Image, bool) {
+	changed := false
+
+	if s.TrimBorders {
+		if trimmed, ok := trimBorders(img); ok {
+			img = trimmed
+			changed = true
+		}
+	}
+
+	if s.Grayscale {
+		if _, ok := img.(*image.Gray); !ok && isGrayscale(img) {
+			img = toGray(img)
+			changed = true
+		}
+	}
+
+	if s.MaxWidth > 0 || s.MaxHeight > 0 {
+		if resized, ok := resizeImage(img, s.MaxWidth, s.MaxHeight); ok {
+			img = resized
+			changed = true
+		}
+	}
+
+	return img, changed
+}
+
+// trimBorders removes uniform white or black borders around the page.
+// Pages that are uniform all over are left alone.
+func trimBorders(img image.Image) (image.Image, bool) {
+	bounds := img.Bounds()
+	border, ok := borderColor(img.At(bounds.Min.X, bounds.Min.Y))
+	if !ok {
+		return img, false
+	}
+
+	rowUniform := func(y int) bool {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			if !nearColor(img.At(x, y), border) {
+				return false
+			}
+		}
+		return true
+	}
+	colUniform := func(x, minY, maxY int) bool {
+		for y := minY; y < maxY; y++ {
+			if !nearColor(img.At(x, y), border) {
+				return false
+			}
+		}
+		return true
+	}
+
+	top := bounds.Min.Y
+	for top < bounds.Max.Y && rowUniform(top) {
+		top++
+	}
+	if top == bounds.Max.Y {
+		return img, false
+	}
+	bottom := bounds.Max.Y
+	for bottom > top && rowUniform(bottom-1) {
+		bottom--
+	}
+	left := bounds.Min.X
+	for left < bounds.Max.X && colUniform(left, top, bottom) {
+		left++
+	}
+	right := bounds.Max.X
+	for right > left && colUniform(right-1, top, bottom) {
+		right--
+	}
+
+	rect := image.Rect(left, top, right, bottom)
+	if rect == bounds {
+		return img, false
+	}
+
+	if sub, ok := img.(interface {
+		SubImage(r image.Rectangle) image.Image
+	}); ok {
+		return sub.SubImage(rect), true
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, rect.Dx(), rect.Dy()))
+	draw.Draw(dst, dst.Bounds(), img, rect.Min, draw.Src)
+	return dst, true
+}
+
+// borderColor returns the color of a corner pixel if it is near white or
+// near black, the only borders that are trimmed
+func borderColor(c color.Color) (color.RGBA, bool) {
+	r, g, b, _ := c.RGBA()
+	rgb := color.RGBA{R: uint8(r >> 8), G: uint8(g >> 8), B: uint8(b >> 8), A: 0xff}
+	switch {
+	case rgb.R >= borderWhite && rgb.G >= borderWhite && rgb.B >= borderWhite:
+		return rgb, true
+	case rgb.R <= borderBlack && rgb.G <= borderBlack && rgb.B <= borderBlack:
+		return rgb, true
+	}
+	return rgb, false
+}
+
+// nearColor checks that every channel of c is within borderTolerance of ref
+func nearColor(c color.Color, ref color.RGBA) bool {
+	r, g, b, _ := c.RGBA()
+	return absDiff(uint8(r>>8), ref.R) <= borderTolerance &&
+		absDiff(uint8(g>>8), ref.G) <= borderTolerance &&
+		absDiff(uint8(b>>8), ref.B) <= borderTolerance
+}
+
+// isGrayscale reports whether a page has no visible color
+func isGrayscale(img image.Image) bool {
+	switch src := img.(type) {
+	case *image.Gray:
+		return true
+	case *image.YCbCr:
+		// Gray pixels have neutral chroma, so only the chroma planes matter
+		for _, plane := range [][]byte{src.Cb, src.Cr} {
+			for _, v := range plane {
+				if absDiff(v, 128) > grayTolerance {
+					return false
+				}
+			}
+		}
+		return true
+	}
+
+	bounds := img.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			r, g, b, _ := img.At(x, y).RGBA()
+			r8, g8, b8 := uint8(r>>8), uint8(g>>8), uint8(b>>8)
+			if absDiff(r8, g8) > grayTolerance || absDiff(g8, b8) > grayTolerance || absDiff(r8, b8) > grayTolerance {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// toGray converts an image to a single-channel image
+func toGray(img image.Image) *image.Gray {
+	bounds := img.Bounds()
+	gray := image.NewGray(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(gray, gray.Bounds(), img, bounds.Min, draw.Src)
+	return gray
+}
+
+// resizeImage downsizes an image to fit within maxWidth x maxHeight while
+// keeping its aspect ratio. Zero limits are ignored.
+func resizeImage(img image.Image, maxWidth, maxHeight int) (image.Image, bool) {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+
+	scale := 1.0
+	if maxWidth > 0 && width > maxWidth {
+		scale = float64(maxWidth) / float64(width)
+	}
+	if maxHeight > 0 && height > maxHeight {
+		if s := float64(maxHeight) / float64(height); s < scale {
+			scale = s
+		}
+	}
+	if scale >= 1 {
+		return img, false
+	}
+
+	newWidth := int(float64(width)*scale + 0.5)
+	newHeight := int(float64(height)*scale + 0.5)
+	if newWidth < 1 {
+		newWidth = 1
+	}
+	if newHeight < 1 {
+		newHeight = 1
+	}
+
+	rect := image.Rect(0, 0, newWidth, newHeight)
+	var dst draw.Image
+	if _, ok := img.(*image.Gray); ok {
+		dst = image.NewGray(rect)
+	} else {
+		dst = image.NewRGBA(rect)
+	}
+	xdraw.CatmullRom.Scale(dst, rect, img, bounds, xdraw.Src, nil)
+	return dst, true
+}
+
+// absDiff returns the absolute difference of two bytes
+func absDiff(a, b uint8) uint8 {
+	if a > b {
+		return a - b
+	}
+	return b - a
+}
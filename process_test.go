@@ -0,0 +1,108 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"testing"
+)
+
+var (
+	white = color.RGBA{255, 255, 255, 255}
+	black = color.RGBA{0, 0, 0, 255}
+	red   = color.RGBA{200, 30, 30, 255}
+	gray  = color.RGBA{120, 120, 120, 255}
+)
+
+// boxPage returns a page filled with bg and a box of fg
+func boxPage(width, height int, bg, fg color.Color, box image.Rectangle) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(img, img.Bounds(), image.NewUniform(bg), image.Point{}, draw.Src)
+	draw.Draw(img, box, image.NewUniform(fg), image.Point{}, draw.Src)
+	return img
+}
+
+func TestTrimBorders(t *testing.T) {
+	tests := []struct {
+		name    string
+		img     image.Image
+		want    image.Rectangle
+		trimmed bool
+	}{
+		{"white border", boxPage(40, 60, white, red, image.Rect(5, 8, 30, 50)), image.Rect(5, 8, 30, 50), true},
+		{"black border", boxPage(40, 60, black, gray, image.Rect(0, 10, 40, 55)), image.Rect(0, 10, 40, 55), true},
+		{"near-white border", boxPage(40, 60, color.RGBA{245, 240, 250, 255}, red, image.Rect(3, 3, 37, 57)), image.Rect(3, 3, 37, 57), true},
+		{"no border", boxPage(40, 60, white, red, image.Rect(0, 0, 40, 60)), image.Rect(0, 0, 40, 60), false},
+		{"colored border", boxPage(40, 60, red, white, image.Rect(5, 5, 35, 55)), image.Rect(0, 0, 40, 60), false},
+		{"blank page", boxPage(40, 60, white, white, image.Rect(5, 5, 35, 55)), image.Rect(0, 0, 40, 60), false},
+	}
+
+	for _, tc := range tests {
+		img, trimmed := trimBorders(tc.img)
+		if trimmed != tc.trimmed || img.Bounds() != tc.want {
+			t.Errorf("%s: bounds %v (trimmed %v), want %v (trimmed %v)", tc.name, img.Bounds(), trimmed, tc.want, tc.trimmed)
+		}
+	}
+}
+
+func TestResizeImageKeepsAspectRatio(t *testing.T) {
+	tests := []struct {
+		name                string
+		width, height       int
+		maxWidth, maxHeight int
+		wantW, wantH        int
+		resized             bool
+	}{
+		{"width limit", 400, 600, 200, 0, 200, 300, true},
+		{"height limit", 400, 600, 0, 300, 200, 300, true},
+		{"tighter limit wins", 400, 600, 300, 150, 100, 150, true},
+		{"rounding", 333, 500, 100, 0, 100, 150, true},
+		{"within limits", 400, 600, 400, 600, 400, 600, false},
+		{"no limits", 400, 600, 0, 0, 400, 600, false},
+		{"never enlarged", 100, 150, 1000, 1000, 100, 150, false},
+	}
+
+	for _, tc := range tests {
+		src := boxPage(tc.width, tc.height, white, red, image.Rect(0, 0, tc.width/2, tc.height))
+		img, resized := resizeImage(src, tc.maxWidth, tc.maxHeight)
+		if resized != tc.resized || img.Bounds().Dx() != tc.wantW || img.Bounds().Dy() != tc.wantH {
+			t.Errorf("%s: %dx%d (resized %v), want %dx%d (resized %v)",
+				tc.name, img.Bounds().Dx(), img.Bounds().Dy(), resized, tc.wantW, tc.wantH, tc.resized)
+		}
+	}
+
+	// Gray pages stay single-channel
+	grayPage := toGray(boxPage(400, 600, white, black, image.Rect(0, 0, 200, 600)))
+	if img, _ := resizeImage(grayPage, 200, 0); img.ColorModel() != color.GrayModel {
+		t.Errorf("resized gray page has color model %v", img.ColorModel())
+	}
+}
+
+func TestProcessImage(t *testing.T) {
+	page := boxPage(400, 600, white, gray, image.Rect(50, 100, 350, 500))
+	colored := boxPage(400, 600, white, red, image.Rect(50, 100, 350, 500))
+
+	tests := []struct {
+		name     string
+		img      image.Image
+		settings ImageProcessing
+		want     image.Rectangle
+		gray     bool
+		changed  bool
+	}{
+		{"nothing enabled", page, ImageProcessing{}, image.Rect(0, 0, 400, 600), false, false},
+		{"trim", page, ImageProcessing{TrimBorders: true}, image.Rect(50, 100, 350, 500), false, true},
+		{"trim then resize", page, ImageProcessing{TrimBorders: true, MaxWidth: 150}, image.Rect(0, 0, 150, 200), false, true},
+		{"grayscale", page, ImageProcessing{Grayscale: true}, image.Rect(0, 0, 400, 600), true, true},
+		{"grayscale keeps color", colored, ImageProcessing{Grayscale: true}, image.Rect(0, 0, 400, 600), false, false},
+	}
+
+	for _, tc := range tests {
+		img, changed := processImage(tc.img, tc.settings)
+		_, isGray := img.(*image.Gray)
+		if img.Bounds() != tc.want || isGray != tc.gray || changed != tc.changed {
+			t.Errorf("%s: bounds %v, gray %v, changed %v; want %v, %v, %v",
+				tc.name, img.Bounds(), isGray, changed, tc.want, tc.gray, tc.changed)
+		}
+	}
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Download stages
+const (
+	StageQueued     = "queued"
+	StageMetadata   = "metadata"
+	StageDownload   = "download"
+	StageDescramble = "descramble"
+	StagePDF        = "pdf"
+	StageEncrypt    = "encrypt"
+	StageUpload     = "upload"
+	StageDone       = "done"
+)
+
+// stageNames are the display names of each stage
+var stageNames = map[string]string{
+	StageQueued:     "排队中",
+	StageMetadata:   "获取信息",
+	StageDownload:   "下载图片",
+	StageDescramble: "解码图片",
+	StagePDF:        "生成PDF",
+	StageEncrypt:    "加密PDF",
+	StageUpload:     "上传文件",
+	StageDone:       "已完成",
+}
+
+// Progress tracks how far a download job has got.
+// All methods are safe to call on a nil *Progress.
+type Progress struct {
+	mu           sync.Mutex
+	stage        string
+	stageStarted time.Time
+	started      time.Time
+	total        int
+	downloaded   int
+	decoded      int
+	cached       int // Images taken from disk, not counted in the download rate
+	pages        int
+	bytes        int64
+}
+
+// ProgressSnapshot is a point-in-time copy of a job's progress
+type ProgressSnapshot struct {
+	Stage      string
+	Total      int
+	Downloaded int
+	Decoded    int
+	Pages      int
+	Bytes      int64
+	Elapsed    time.Duration
+	ETA        time.Duration // 0 if unknown
+}
+
+// NewProgress creates a progress tracker in the queued stage
+func NewProgress() *Progress {
+	now := time.Now()
+	return &Progress{
+		stage:        StageQueued,
+		stageStarted: now,
+		started:      now,
+	}
+}
+
+// SetStage moves the job to a new stage
+func (p *Progress) SetStage(stage string) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.stage == StageQueued {
+		p.started = time.Now()
+	}
+	p.stage = stage
+	p.stageStarted = time.Now()
+}
+
+// SetTotal sets the number of images in the job
+func (p *Progress) SetTotal(total int) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	p.total = total
+	p.mu.Unlock()
+}
+
+// AddDownloaded records a finished image download of size bytes
+func (p *Progress) AddDownloaded(bytes int64) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	p.downloaded++
+	p.bytes += bytes
+	p.mu.Unlock()
+}
+
+// DropDownloaded takes back a download recorded with AddDownloaded when
+// the image could not be saved and will be retried
+func (p *Progress) DropDownloaded(bytes int64) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	p.downloaded--
+	p.bytes -= bytes
+	p.mu.Unlock()
+}
+
+// AddCached records an image that was already on disk. It counts as
+// downloaded and decoded but not towards the download rate.
+func (p *Progress) AddCached() {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	p.downloaded++
+	p.decoded++
+	p.cached++
+	p.mu.Unlock()
+}
+
+// AddDecoded records an image that was descrambled and saved
+func (p *Progress) AddDecoded() {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	p.decoded++
+	p.mu.Unlock()
+}
+
+// AddPage records a page written to the PDF
+func (p *Progress) AddPage() {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	p.pages++
+	p.mu.Unlock()
+}
+
+// Snapshot returns the current progress
+func (p *Progress) Snapshot() ProgressSnapshot {
+	if p == nil {
+		return ProgressSnapshot{Stage: StageQueued}
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	s := ProgressSnapshot{
+		Stage:      p.stage,
+		Total:      p.total,
+		Downloaded: p.downloaded,
+		Decoded:    p.decoded,
+		Pages:      p.pages,
+		Bytes:      p.bytes,
+	}
+	if p.stage != StageQueued {
+		s.Elapsed = time.Since(p.started)
+	}
+
+	// Images are decoded right after they arrive, so once every image is
+	// downloaded the job is only waiting for descrambling
+	if s.Stage == StageDownload && s.Total > 0 && s.Downloaded >= s.Total && s.Decoded < s.Total {
+		s.Stage = StageDescramble
+	}
+
+	// Estimate remaining time from the rate of the current stage. Cached
+	// images took no time, so only images fetched in this run give the rate.
+	done, timed := 0, 0
+	switch s.Stage {
+	case StageDownload, StageDescramble:
+		done, timed = s.Decoded, s.Decoded-p.cached
+	case StagePDF:
+		done, timed = s.Pages, s.Pages
+	}
+	if timed > 0 && s.Total > done {
+		perItem := time.Since(p.stageStarted) / time.Duration(timed)
+		s.ETA = perItem * time.Duration(s.Total-done)
+	}
+
+	return s
+}
+
+// Percent returns the overall completion of the current stage
+func (s ProgressSnapshot) Percent() float64 {
+	if s.Total == 0 {
+		return 0
+	}
+	done := 0
+	switch s.Stage {
+	case StageDownload, StageDescramble:
+		done = s.Decoded
+	case StagePDF:
+		done = s.Pages
+	case StageEncrypt, StageUpload, StageDone:
+		done = s.Total
+	}
+	return float64(done) * 100 / float64(s.Total)
+}
+
+// String formats the progress for a chat message
+func (s ProgressSnapshot) String() string {
+	name := stageNames[s.Stage]
+	if name == "" {
+		name = s.Stage
+	}
+
+	switch s.Stage {
+	case StageDownload, StageDescramble:
+		text := fmt.Sprintf("%s %d/%d (%.1f%%) 已下载 %s", name, s.Decoded, s.Total, s.Percent(), formatBytes(s.Bytes))
+		if s.ETA > 0 {
+			text += " 预计剩余 " + formatDuration(s.ETA)
+		}
+		return text
+	case StagePDF:
+		text := fmt.Sprintf("%s %d/%d (%.1f%%)", name, s.Pages, s.Total, s.Percent())
+		if s.ETA > 0 {
+			text += " 预计剩余 " + formatDuration(s.ETA)
+		}
+		return text
+	}
+	return name
+}
+
+// formatBytes formats a byte count for display
+func formatBytes(n int64) string {
+	switch {
+	case n >= 1<<30:
+		return fmt.Sprintf("%.2fGB", float64(n)/(1<<30))
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1fMB", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.1fKB", float64(n)/(1<<10))
+	}
+	return fmt.Sprintf("%dB", n)
+}
+
+// formatDuration formats a duration as minutes and seconds
+func formatDuration(d time.Duration) string {
+	d = d.Round(time.Second)
+	if d >= time.Minute {
+		return fmt.Sprintf("%d分%d秒", int(d.Minutes()), int(d.Seconds())%60)
+	}
+	return fmt.Sprintf("%d秒", int(d.Seconds()))
+}
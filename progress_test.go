@@ -0,0 +1,63 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestProgressCachedImagesDoNotSetRate(t *testing.T) {
+	p := NewProgress()
+	p.SetStage(StageDownload)
+	p.SetTotal(100)
+	for i := 0; i < 90; i++ {
+		p.AddCached()
+	}
+
+	s := p.Snapshot()
+	if s.Decoded != 90 || s.Bytes != 0 {
+		t.Fatalf("decoded %d bytes %d, want 90 and 0", s.Decoded, s.Bytes)
+	}
+	if s.ETA != 0 {
+		t.Fatalf("ETA %v with no image fetched in this run, want unknown", s.ETA)
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	p.AddDownloaded(1000)
+	p.AddDecoded()
+	s = p.Snapshot()
+	// One fetched image took at least 20ms, so 9 more take at least 180ms
+	if s.ETA < 180*time.Millisecond {
+		t.Fatalf("ETA %v, want at least 180ms from the fetched image only", s.ETA)
+	}
+}
+
+func TestProgressDroppedDownloadKeepsStage(t *testing.T) {
+	p := NewProgress()
+	p.SetStage(StageDownload)
+	p.SetTotal(2)
+
+	// An image that validated but failed to save is retried
+	p.AddDownloaded(10)
+	p.DropDownloaded(10)
+	p.AddDownloaded(10)
+	p.AddDecoded()
+	p.AddDownloaded(10)
+
+	s := p.Snapshot()
+	if s.Downloaded != 2 || s.Bytes != 20 {
+		t.Fatalf("downloaded %d bytes %d, want 2 and 20", s.Downloaded, s.Bytes)
+	}
+	if s.Stage != StageDescramble {
+		t.Fatalf("stage %q, want %q once every image arrived", s.Stage, StageDescramble)
+	}
+
+	p = NewProgress()
+	p.SetStage(StageDownload)
+	p.SetTotal(2)
+	p.AddDownloaded(10)
+	p.DropDownloaded(10)
+	p.AddDownloaded(10)
+	if s := p.Snapshot(); s.Stage != StageDownload {
+		t.Fatalf("stage %q after a retried image, want %q", s.Stage, StageDownload)
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestRateLimiterWaitNStopsWhenCancelled(t *testing.T) {
+	l := NewRateLimiter(1000)
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+
+	// 10 seconds of debt at 1000 bytes per second
+	start := time.Now()
+	err := l.WaitN(ctx, 11000)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("WaitN returned %v, want context.Canceled", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("WaitN returned %v after the cancel", elapsed)
+	}
+}
+
+func TestRateLimiterWaitsWithinBurst(t *testing.T) {
+	l := NewRateLimiter(1 << 20)
+	start := time.Now()
+	if err := l.WaitN(context.Background(), 1024); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+		t.Errorf("WaitN within the burst took %v", elapsed)
+	}
+
+	var nilLimiter *RateLimiter
+	if err := nilLimiter.WaitN(context.Background(), 1<<30); err != nil {
+		t.Errorf("nil limiter returned %v", err)
+	}
+}
+
+func TestRateLimiterReaderStopsWhenCancelled(t *testing.T) {
+	l := NewRateLimiter(1024)
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+
+	start := time.Now()
+	_, err := io.ReadAll(l.Reader(ctx, bytes.NewReader(make([]byte, 64*1024))))
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("read returned %v, want context.Canceled", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("read returned %v after the cancel", elapsed)
+	}
+}
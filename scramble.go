@@ -0,0 +1,93 @@
+package main
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// ScrambleRule describes how JM cuts the pages of photos from MinPhotoID on.
+// A page is cut into either a fixed number of segments, or into
+// (last hex char of md5(HashInput) % Modulus) * 2 + 2 segments.
+type ScrambleRule struct {
+	MinPhotoID int    `json:"min_photo_id"`         // First photo ID the rule applies to
+	Segments   int    `json:"segments,omitempty"`   // Fixed segment count, used when Modulus is 0
+	Modulus    int    `json:"modulus,omitempty"`    // Modulus applied to the hash
+	HashInput  string `json:"hash_input,omitempty"` // Hash input, {aid} is the photo ID and {name} the file name without extension
+}
+
+// DefaultScrambleRules returns the scramble eras known from
+// JMComic-Crawler-Python
+func DefaultScrambleRules() []ScrambleRule {
+	return []ScrambleRule{
+		{MinPhotoID: 0, Segments: 10},
+		{MinPhotoID: SCRAMBLE_268850, Modulus: 10, HashInput: "{aid}{name}"},
+		{MinPhotoID: SCRAMBLE_421926, Modulus: 8, HashInput: "{aid}{name}"}, // 2023-02-08 changed image cutting algorithm
+	}
+}
+
+// ValidateScrambleRules checks that a rule table is sorted by photo ID and
+// that every rule yields a usable segment count
+func ValidateScrambleRules(rules []ScrambleRule) error {
+	for i, rule := range rules {
+		if rule.MinPhotoID < 0 {
+			return fmt.Errorf("rule %d: min_photo_id must not be negative", i+1)
+		}
+		if i > 0 && rule.MinPhotoID <= rules[i-1].MinPhotoID {
+			return fmt.Errorf("rule %d: min_photo_id must be greater than the previous rule's", i+1)
+		}
+
+		if rule.Modulus == 0 {
+			if rule.Segments <= 0 {
+				return fmt.Errorf("rule %d: either segments or modulus must be positive", i+1)
+			}
+			continue
+		}
+
+		if rule.Modulus < 0 {
+			return fmt.Errorf("rule %d: modulus must not be negative", i+1)
+		}
+		if rule.Segments != 0 {
+			return fmt.Errorf("rule %d: segments and modulus are mutually exclusive", i+1)
+		}
+		if !strings.Contains(rule.HashInput, "{aid}") && !strings.Contains(rule.HashInput, "{name}") {
+			return fmt.Errorf("rule %d: hash_input must contain {aid} or {name}", i+1)
+		}
+	}
+	return nil
+}
+
+// scrambleSegments returns the number of segments a page was cut into, or
+// 0 if no rule applies to the photo
+func scrambleSegments(rules []ScrambleRule, aid int, filename string) int {
+	// Use the last rule whose threshold the photo has reached
+	var rule *ScrambleRule
+	for i := range rules {
+		if aid >= rules[i].MinPhotoID {
+			rule = &rules[i]
+		}
+	}
+	if rule == nil {
+		return 0
+	}
+
+	if rule.Modulus == 0 {
+		return rule.Segments
+	}
+
+	// Remove file extension from filename (important!)
+	// Python: of_file_name(url, trim_suffix=True)
+	name := strings.TrimSuffix(filename, filepath.Ext(filename))
+
+	// MD5 hash based calculation
+	s := strings.NewReplacer("{aid}", strconv.Itoa(aid), "{name}", name).Replace(rule.HashInput)
+	hash := md5.Sum([]byte(s))
+	hashHex := hex.EncodeToString(hash[:])
+
+	// Get last character's ASCII value
+	num := int(hashHex[len(hashHex)-1])
+	return num%rule.Modulus*2 + 2
+}
@@ -0,0 +1,273 @@
+package main
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+var updateGolden = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// Segment counts worked out independently from md5(aid + name)
+var scrambleVectors = []struct {
+	photoID  int
+	filename string
+	want     int
+}{
+	// Before the scramble ID pages are not cut
+	{220979, "00001.jpg", 0},
+	// 220980 era: always 10 segments
+	{220980, "00001.jpg", 10},
+	{250000, "00042.webp", 10},
+	{268849, "00001.jpg", 10},
+	// 268850 era: last md5 hex char % 10 * 2 + 2
+	{268850, "00001.webp", 6},
+	{300000, "00005.jpg", 2},
+	{350000, "00012.webp", 4},
+	{421925, "00020.jpg", 12},
+	// 421926 era: last md5 hex char % 8 * 2 + 2
+	{421926, "00001.webp", 14},
+	{500000, "00010.jpg", 8},
+	{1000000, "00003.png", 14},
+	{1230000, "00100.webp", 16},
+}
+
+func TestGetScrambleNum(t *testing.T) {
+	client := NewJMClient(DefaultConfig())
+	for _, v := range scrambleVectors {
+		got := client.GetScrambleNum(strconv.Itoa(SCRAMBLE_220980), strconv.Itoa(v.photoID), v.filename)
+		if got != v.want {
+			t.Errorf("GetScrambleNum(%d, %s) = %d, want %d", v.photoID, v.filename, got, v.want)
+		}
+	}
+}
+
+func TestGetScrambleNumIgnoresExtension(t *testing.T) {
+	client := NewJMClient(DefaultConfig())
+	for _, ext := range []string{".jpg", ".webp", ".png", ""} {
+		if got := client.GetScrambleNum("220980", "300000", "00005"+ext); got != 2 {
+			t.Errorf("GetScrambleNum(300000, 00005%s) = %d, want 2", ext, got)
+		}
+	}
+}
+
+// copyPixels copies segH rows from srcY in src to dstY in dst one pixel at
+// a time, independent of copyRows
+func copyPixels(dst draw.Image, src image.Image, dstY, srcY, segH int) {
+	width := src.Bounds().Dx()
+	for y := 0; y < segH; y++ {
+		for x := 0; x < width; x++ {
+			dst.Set(x, dstY+y, src.At(x, srcY+y))
+		}
+	}
+}
+
+// scramble cuts a page the way JM does: the inverse of descramble
+func scramble(img *image.RGBA, num int) *image.RGBA {
+	height := img.Bounds().Dy()
+	result := image.NewRGBA(img.Bounds())
+	over := height % num
+	move := height / num
+	for i := 0; i < num; i++ {
+		srcY := height - move*(i+1) - over
+		dstY := move * i
+		segH := move
+		if i == 0 {
+			segH += over
+		} else {
+			dstY += over
+		}
+		copyPixels(result, img, srcY, dstY, segH)
+	}
+	return result
+}
+
+// testPage returns a page whose rows can all be told apart
+func testPage(width, height int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.SetRGBA(x, y, color.RGBA{uint8(y), uint8(y >> 8), uint8(x), 255})
+		}
+	}
+	return img
+}
+
+// rgbaPix returns the pixels of img as RGBA bytes
+func rgbaPix(img image.Image) []byte {
+	if rgba, ok := img.(*image.RGBA); ok {
+		return rgba.Pix
+	}
+	rgba := image.NewRGBA(img.Bounds())
+	draw.Draw(rgba, rgba.Bounds(), img, img.Bounds().Min, draw.Src)
+	return rgba.Pix
+}
+
+// goldenPages are scrambled pages kept in testdata/scrambled, one or more
+// per era. Each descrambles to testPage(goldenWidth, height).
+var goldenPages = []struct {
+	photoID  int
+	name     string
+	height   int
+	segments int
+}{
+	{250000, "00042", 97, 10},  // 220980 era
+	{268850, "00001", 120, 6},  // 268850 era, height divisible
+	{421925, "00020", 97, 12},  // 268850 era, last photo
+	{421926, "00001", 301, 14}, // 421926 era
+	{1230000, "00100", 97, 16}, // 421926 era
+}
+
+const goldenWidth = 23
+
+func TestDecodeScrambledImageGolden(t *testing.T) {
+	client := NewJMClient(DefaultConfig())
+	for _, g := range goldenPages {
+		path := filepath.Join("testdata", "scrambled", fmt.Sprintf("%d-%s.png", g.photoID, g.name))
+		original := testPage(goldenWidth, g.height)
+
+		if *updateGolden {
+			var buf bytes.Buffer
+			if err := png.Encode(&buf, scramble(original, g.segments)); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("%v (run with -update to create the golden files)", err)
+		}
+		chapter := &Chapter{ID: strconv.Itoa(g.photoID), ScrambleID: "220980"}
+		if n := client.GetScrambleNum(chapter.ScrambleID, chapter.ID, g.name+".png"); n != g.segments {
+			t.Fatalf("%s: %d segments, golden file was cut into %d", path, n, g.segments)
+		}
+
+		decoded, err := client.DecodeScrambledImage(data, chapter, g.name+".png")
+		if err != nil {
+			t.Fatalf("%s: %v", path, err)
+		}
+		img, _, err := image.Decode(bytes.NewReader(decoded))
+		if err != nil {
+			t.Fatalf("%s: %v", path, err)
+		}
+		if !bytes.Equal(rgbaPix(img), original.Pix) {
+			t.Errorf("%s: descrambled page differs from the original", path)
+		}
+	}
+}
+
+func TestDecodeScrambledImageRoundTrip(t *testing.T) {
+	client := NewJMClient(DefaultConfig())
+	for _, v := range scrambleVectors {
+		if v.want == 0 {
+			continue
+		}
+		// Heights that divide evenly, and ones that leave a remainder of
+		// rows for the first segment
+		for _, height := range []int{v.want * 40, 97, 1131} {
+			name := fmt.Sprintf("%d/%s/%dpx", v.photoID, v.filename, height)
+			original := testPage(goldenWidth, height)
+
+			scrambled := scramble(original, v.want)
+			if bytes.Equal(scrambled.Pix, original.Pix) {
+				t.Fatalf("%s: scrambling left the page unchanged", name)
+			}
+			var buf bytes.Buffer
+			if err := png.Encode(&buf, scrambled); err != nil {
+				t.Fatal(err)
+			}
+			chapter := &Chapter{ID: strconv.Itoa(v.photoID), ScrambleID: "220980"}
+			decoded, err := client.DecodeScrambledImage(buf.Bytes(), chapter, v.filename)
+			if err != nil {
+				t.Fatalf("%s: %v", name, err)
+			}
+
+			img, format, err := image.Decode(bytes.NewReader(decoded))
+			if err != nil {
+				t.Fatalf("%s: %v", name, err)
+			}
+			if format != "png" {
+				t.Errorf("%s: format %q, want png", name, format)
+			}
+			if !bytes.Equal(rgbaPix(img), original.Pix) {
+				t.Errorf("%s: descrambled page differs from the original", name)
+			}
+		}
+	}
+}
+
+func TestDecodeScrambledImageKeepsUnscrambledPages(t *testing.T) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, testPage(10, 20)); err != nil {
+		t.Fatal(err)
+	}
+	chapter := &Chapter{ID: "220979", ScrambleID: "220980"}
+	decoded, err := NewJMClient(DefaultConfig()).DecodeScrambledImage(buf.Bytes(), chapter, "00001.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(decoded, buf.Bytes()) {
+		t.Error("unscrambled page was re-encoded")
+	}
+}
+
+// legacyScrambleNum is the hard-coded era logic the rule table replaced
+func legacyScrambleNum(aid int, filename string) int {
+	if aid < SCRAMBLE_268850 {
+		return 10
+	}
+	x := 10
+	if aid >= SCRAMBLE_421926 {
+		x = 8
+	}
+	name := strings.TrimSuffix(filename, filepath.Ext(filename))
+	hash := md5.Sum([]byte(fmt.Sprintf("%d%s", aid, name)))
+	hashHex := hex.EncodeToString(hash[:])
+	return int(hashHex[len(hashHex)-1])%x*2 + 2
+}
+
+func TestDefaultScrambleRulesMatchLegacyEras(t *testing.T) {
+	rules := DefaultScrambleRules()
+	if err := ValidateScrambleRules(rules); err != nil {
+		t.Fatal(err)
+	}
+
+	// Every photo around the era boundaries, and a spread of others
+	var aids []int
+	for _, boundary := range []int{SCRAMBLE_220980, SCRAMBLE_268850, SCRAMBLE_421926} {
+		for aid := boundary - 50; aid <= boundary+50; aid++ {
+			aids = append(aids, aid)
+		}
+	}
+	for aid := 1; aid < 2000000; aid += 7919 {
+		aids = append(aids, aid)
+	}
+
+	for _, aid := range aids {
+		for page := 1; page <= 40; page++ {
+			for _, ext := range []string{".jpg", ".webp"} {
+				filename := fmt.Sprintf("%05d%s", page, ext)
+				if got, want := scrambleSegments(rules, aid, filename), legacyScrambleNum(aid, filename); got != want {
+					t.Fatalf("scrambleSegments(%d, %s) = %d, legacy code gave %d", aid, filename, got, want)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"os"
+)
+
+// Size targeting
+const (
+	targetHeadroom   = 0.95 // Aim this far below the budget to leave room for estimate errors
+	targetSamples    = 6    // Pages encoded to estimate the compressed size
+	targetMinQuality = 30   // Lowest quality a page is lowered to when it exceeds its share
+)
+
+// sizeTarget is the compression chosen to fit a PDF into a byte budget
+type sizeTarget struct {
+	quality int     // Starting JPEG quality for every page
+	scale   float64 // Downscale factor, 1 keeps the size
+	ratio   float64 // Budget bytes per source byte, gives each page its share
+}
+
+// String describes the settings for the log
+func (t sizeTarget) String() string {
+	if t.scale < 1 {
+		return fmt.Sprintf("quality %d, scale %.0f%%", t.quality, t.scale*100)
+	}
+	return fmt.Sprintf("quality %d", t.quality)
+}
+
+// targetCandidates returns the settings to try, from mildest to strongest
+func (p *PDFGenerator) targetCandidates() []sizeTarget {
+	candidates := make([]sizeTarget, 0)
+	for _, q := range []int{85, 75, 65, 55, 45, 35} {
+		candidates = append(candidates, sizeTarget{quality: q, scale: 1})
+	}
+	if p.config.TargetDownscale {
+		for _, scale := range []float64{0.85, 0.7, 0.55} {
+			for _, q := range []int{65, 50, 35} {
+				candidates = append(candidates, sizeTarget{quality: q, scale: scale})
+			}
+		}
+	}
+	return candidates
+}
+
+// createTargetPDF creates a PDF that stays under the configured size
+// budget. Pages are only recompressed if their total size exceeds the
+// budget; the settings are estimated from sample pages and tightened until
+// the file fits.
+func (p *PDFGenerator) createTargetPDF(ctx context.Context, pdfPath string, images []DownloadedImage) error {
+	budget := int64(p.config.PDFTargetSizeMB) << 20
+
+	var total int64
+	for _, img := range images {
+		total += img.Size
+	}
+	if total <= int64(float64(budget)*targetHeadroom) {
+		p.target = nil
+		return p.createSinglePDF(ctx, pdfPath, images)
+	}
+
+	candidates := p.targetCandidates()
+	start := p.estimateTarget(images, total, budget, candidates)
+
+	// Retries must not count pages twice
+	progress := p.progress
+	defer func() { p.progress = progress }()
+
+	var size int64
+	for i := start; i < len(candidates); i++ {
+		target := candidates[i]
+		target.ratio = float64(budget) * targetHeadroom / float64(total)
+		p.target = &target
+
+		if err := p.createSinglePDF(ctx, pdfPath, images); err != nil {
+			p.target = nil
+			return err
+		}
+		p.progress = nil
+
+		info, err := os.Stat(pdfPath)
+		if err != nil {
+			p.target = nil
+			return err
+		}
+		size = info.Size()
+		if size <= budget {
+			p.logf("info", "PDF %s: %s -> %s with %s (budget %s)",
+				pdfPath, formatBytes(total), formatBytes(size), target, formatBytes(budget))
+			p.target = nil
+			return nil
+		}
+	}
+
+	// Keep the smallest version even if it is still too big
+	p.logf("warn", "PDF %s is %s with the strongest compression, over the %s budget",
+		pdfPath, formatBytes(size), formatBytes(budget))
+	p.target = nil
+	return nil
+}
+
+// estimateTarget encodes sample pages with each candidate and returns the
+// index of the mildest one expected to fit the budget
+func (p *PDFGenerator) estimateTarget(images []DownloadedImage, total, budget int64, candidates []sizeTarget) int {
+	// Pick pages spread evenly over the PDF
+	samples := make([]image.Image, 0, targetSamples)
+	var sampleBytes int64
+	step := len(images)/targetSamples + 1
+	for i := 0; i < len(images) && len(samples) < targetSamples; i += step {
+		if images[i].Missing {
+			continue
+		}
+		src, err := readPage(images[i].Path)
+		if err != nil {
+			continue
+		}
+		img, err := src.decode()
+		if err != nil {
+			continue
+		}
+		img, _ = processImage(img, p.config.Processing)
+		samples = append(samples, img)
+		sampleBytes += int64(len(src.data))
+	}
+	if len(samples) == 0 || sampleBytes == 0 {
+		return 0
+	}
+
+	limit := float64(budget) * targetHeadroom
+	for i, target := range candidates {
+		var encoded int64
+		for _, img := range samples {
+			page, err := jpegImage(scaleImage(img, target.scale), target.quality)
+			if err != nil {
+				continue
+			}
+			encoded += int64(len(page.Data))
+		}
+		estimate := float64(total) * float64(encoded) / float64(sampleBytes)
+		if estimate <= limit {
+			return i
+		}
+	}
+	return len(candidates) - 1
+}
+
+// targetPage re-encodes a page with the chosen settings, lowering the
+// quality further while the result is larger than the page's share of the
+// budget
+func (p *PDFGenerator) targetPage(img image.Image, original []byte) (PDFImage, error) {
+	share := int(float64(len(original)) * p.target.ratio)
+
+	img = scaleImage(img, p.target.scale)
+	quality := p.target.quality
+	for {
+		page, err := jpegImage(img, quality)
+		if err != nil {
+			return PDFImage{}, err
+		}
+		if len(page.Data) <= share || quality <= targetMinQuality {
+			return page, nil
+		}
+		quality -= 10
+		if quality < targetMinQuality {
+			quality = targetMinQuality
+		}
+	}
+}
+
+// scaleImage downsizes an image by a factor
+func scaleImage(img image.Image, scale float64) image.Image {
+	if scale >= 1 {
+		return img
+	}
+	bounds := img.Bounds()
+	resized, _ := resizeImage(img, int(float64(bounds.Dx())*scale), int(float64(bounds.Dy())*scale))
+	return resized
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// noisyPage returns a JPEG page that compresses poorly
+func noisyPage(t testing.TB, width, height int, seed uint32) []byte {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			seed = seed*1664525 + 1013904223
+			n := uint8(seed >> 27)
+			img.SetRGBA(x, y, color.RGBA{uint8(x) + n, uint8(y) + n, uint8(x+y) + n, 255})
+		}
+	}
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 95}); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestTargetPageReencodesSmallPages(t *testing.T) {
+	data := noisyPage(t, 200, 300, 1)
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := NewPDFGenerator(DefaultConfig())
+	p.target = &sizeTarget{quality: 85, scale: 1, ratio: 0.6}
+	page, err := p.targetPage(img, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page.Filter != "DCTDecode" || bytes.Equal(page.Data, data) {
+		t.Fatal("page was not re-encoded")
+	}
+	if share := int(float64(len(data)) * p.target.ratio); len(page.Data) > share {
+		t.Errorf("page is %d bytes, over its share of %d", len(page.Data), share)
+	}
+}
+
+func TestCreatePDFFitsTargetSize(t *testing.T) {
+	dir := t.TempDir()
+	comic := &Comic{ID: "target"}
+	albumDir := filepath.Join(dir, comic.ID)
+	if err := os.MkdirAll(albumDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	var total int64
+	images := make([]DownloadedImage, 8)
+	for i := range images {
+		data := noisyPage(t, 600, 850, uint32(i))
+		path := filepath.Join(albumDir, fmt.Sprintf("%05d.jpg", i+1))
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		images[i] = DownloadedImage{Index: i, Path: path, Size: int64(len(data)), Filename: filepath.Base(path)}
+		total += int64(len(data))
+	}
+
+	config := DefaultConfig()
+	config.BaseDir = dir
+	config.PDFTargetSizeMB = 1
+	if total <= 1<<20 {
+		t.Fatalf("test album is only %s, not over the budget", formatBytes(total))
+	}
+
+	files, err := NewPDFGenerator(config).CreatePDF(context.Background(), comic, images)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size() > 1<<20 {
+		t.Errorf("PDF is %s, over the 1MB budget (pages were %s)", formatBytes(info.Size()), formatBytes(total))
+	}
+}
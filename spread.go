@@ -0,0 +1,174 @@
+package main
+
+import (
+	"image"
+	"image/draw"
+
+	xdraw "golang.org/x/image/draw"
+)
+
+// spreadRatio is the width to height ratio from which a page is treated as
+// a two-page spread. Single pages are portrait, spreads about 1.4.
+const spreadRatio = 1.2
+
+// isSpread reports whether a page of the given size is a two-page spread
+func isSpread(width, height int) bool {
+	return height > 0 && float64(width) >= float64(height)*spreadRatio
+}
+
+// layoutPage turns one source page into PDF pages according to the spread
+// mode. In merge mode a single page is held in pending until its facing
+// page arrives. Pages that cannot be decoded are skipped and recorded.
+func (p *PDFGenerator) layoutPage(src *pageSource, pending **pageSource, first bool) []PDFImage {
+	switch p.config.Processing.Spreads {
+	case SpreadsSplit:
+		if isSpread(src.width, src.height) {
+			return p.splitPage(src)
+		}
+
+	case SpreadsMerge:
+		// The first page stays single like a book cover and spreads are
+		// already merged, so both end any open pair
+		if first || isSpread(src.width, src.height) {
+			pages := p.flushPending(pending)
+			return append(pages, p.singlePage(src)...)
+		}
+		if *pending == nil {
+			*pending = src
+			return nil
+		}
+		prev := *pending
+		*pending = nil
+		return p.mergePages(prev, src)
+	}
+
+	return p.singlePage(src)
+}
+
+// flushPending returns the page waiting for a facing page, if any
+func (p *PDFGenerator) flushPending(pending **pageSource) []PDFImage {
+	if *pending == nil {
+		return nil
+	}
+	src := *pending
+	*pending = nil
+	return p.singlePage(src)
+}
+
+// singlePage prepares a page as it is
+func (p *PDFGenerator) singlePage(src *pageSource) []PDFImage {
+	page, err := p.preparePage(src)
+	if err != nil {
+		p.skipPage(src.page, err)
+		return nil
+	}
+	page.Sources = []int{src.page}
+	return []PDFImage{page}
+}
+
+// splitPage cuts a spread into its two halves in reading order
+func (p *PDFGenerator) splitPage(src *pageSource) []PDFImage {
+	img, err := src.decode()
+	if err != nil {
+		p.skipPage(src.page, err)
+		return nil
+	}
+
+	bounds := img.Bounds()
+	mid := bounds.Min.X + bounds.Dx()/2
+	sub, ok := img.(interface {
+		SubImage(r image.Rectangle) image.Image
+	})
+	if !ok {
+		return p.singlePage(src)
+	}
+	left := sub.SubImage(image.Rect(bounds.Min.X, bounds.Min.Y, mid, bounds.Max.Y))
+	right := sub.SubImage(image.Rect(mid, bounds.Min.Y, bounds.Max.X, bounds.Max.Y))
+
+	halves := []image.Image{left, right}
+	if p.config.Processing.RightToLeft() {
+		halves = []image.Image{right, left}
+	}
+
+	pages := make([]PDFImage, 0, 2)
+	for _, half := range halves {
+		half, _ = processImage(half, p.config.Processing)
+		page, err := p.encodePage(half, src.format)
+		if err != nil {
+			p.skipPage(src.page, err)
+			continue
+		}
+		page.Sources = []int{src.page}
+		pages = append(pages, page)
+	}
+	return pages
+}
+
+// mergePages puts two facing pages side by side in reading order
+func (p *PDFGenerator) mergePages(first, second *pageSource) []PDFImage {
+	a, errA := first.decode()
+	b, errB := second.decode()
+	if errA != nil || errB != nil {
+		// Keep whichever page is readable
+		return append(p.singlePage(first), p.singlePage(second)...)
+	}
+
+	left, right := a, b
+	if p.config.Processing.RightToLeft() {
+		left, right = b, a
+	}
+	merged := mergeSpread(left, right)
+
+	// Keep lossless storage only if both pages were lossless
+	format := "jpeg"
+	if first.format == second.format {
+		format = first.format
+	}
+
+	merged, _ = processImage(merged, p.config.Processing)
+	page, err := p.encodePage(merged, format)
+	if err != nil {
+		p.skipPage(first.page, err)
+		p.skipPage(second.page, err)
+		return nil
+	}
+	page.Sources = []int{first.page, second.page}
+	return []PDFImage{page}
+}
+
+// mergeSpread draws two pages next to each other, scaling the taller one
+// down to the height of the shorter one
+func mergeSpread(left, right image.Image) image.Image {
+	lb, rb := left.Bounds(), right.Bounds()
+	height := lb.Dy()
+	if rb.Dy() < height {
+		height = rb.Dy()
+	}
+	leftWidth := lb.Dx() * height / lb.Dy()
+	rightWidth := rb.Dx() * height / rb.Dy()
+
+	rect := image.Rect(0, 0, leftWidth+rightWidth, height)
+	var dst draw.Image
+	_, leftGray := left.(*image.Gray)
+	_, rightGray := right.(*image.Gray)
+	if leftGray && rightGray {
+		dst = image.NewGray(rect)
+	} else {
+		dst = image.NewRGBA(rect)
+	}
+	draw.Draw(dst, rect, image.White, image.Point{}, draw.Src)
+
+	drawScaled(dst, image.Rect(0, 0, leftWidth, height), left)
+	drawScaled(dst, image.Rect(leftWidth, 0, leftWidth+rightWidth, height), right)
+	return dst
+}
+
+// drawScaled draws src into r, resampling only if the size differs
+func drawScaled(dst draw.Image, r image.Rectangle, src image.Image) {
+	bounds := src.Bounds()
+	if bounds.Dx() == r.Dx() && bounds.Dy() == r.Dy() {
+		draw.Draw(dst, r, src, bounds.Min, draw.Over)
+		return
+	}
+	xdraw.CatmullRom.Scale(dst, r, src, bounds, xdraw.Over, nil)
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"bytes"
+	"compress/zlib"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"testing"
+)
+
+var blue = color.RGBA{30, 30, 200, 255}
+
+// solidPage returns a page filled with one color
+func solidPage(width, height int, c color.Color) *image.RGBA {
+	return boxPage(width, height, c, c, image.Rectangle{})
+}
+
+// pngSource wraps an image as a lossless source page
+func pngSource(t testing.TB, img image.Image, page int) *pageSource {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	b := img.Bounds()
+	return &pageSource{page: page, data: buf.Bytes(), format: "png", width: b.Dx(), height: b.Dy()}
+}
+
+// pixelAt returns the color at x, y of a FlateDecode RGB page
+func pixelAt(t testing.TB, page PDFImage, x, y int) color.RGBA {
+	t.Helper()
+	if page.Filter != "FlateDecode" || page.Components != 3 {
+		t.Fatalf("page stored as %s with %d components, want FlateDecode RGB", page.Filter, page.Components)
+	}
+	r, err := zlib.NewReader(bytes.NewReader(page.Data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pix, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	i := (y*page.Width + x) * 3
+	return color.RGBA{pix[i], pix[i+1], pix[i+2], 255}
+}
+
+func TestIsSpread(t *testing.T) {
+	tests := []struct {
+		width, height int
+		want          bool
+	}{
+		{700, 1000, false},
+		{1000, 1000, false},
+		{1190, 1000, false},
+		{1200, 1000, true},
+		{1400, 1000, true},
+		{100, 0, false},
+	}
+	for _, tc := range tests {
+		if got := isSpread(tc.width, tc.height); got != tc.want {
+			t.Errorf("isSpread(%d, %d) = %v, want %v", tc.width, tc.height, got, tc.want)
+		}
+	}
+}
+
+func TestSplitPageReadingOrder(t *testing.T) {
+	// Red on the left half, blue on the right
+	spread := boxPage(160, 100, blue, red, image.Rect(0, 0, 80, 100))
+
+	tests := []struct {
+		direction string
+		want      []color.RGBA
+	}{
+		{ReadingRTL, []color.RGBA{blue, red}},
+		{ReadingLTR, []color.RGBA{red, blue}},
+		{"", []color.RGBA{blue, red}}, // Manga order unless ltr is set
+	}
+	for _, tc := range tests {
+		config := DefaultConfig()
+		config.Processing.Spreads = SpreadsSplit
+		config.Processing.ReadingDirection = tc.direction
+		p := NewPDFGenerator(config)
+
+		pages := p.layoutPage(pngSource(t, spread, 1), new(*pageSource), false)
+		if len(pages) != 2 {
+			t.Fatalf("%s: split into %d pages, want 2", tc.direction, len(pages))
+		}
+		for i, page := range pages {
+			if page.Width != 80 || page.Height != 100 {
+				t.Errorf("%s: page %d is %dx%d, want 80x100", tc.direction, i, page.Width, page.Height)
+			}
+			if got := pixelAt(t, page, 40, 50); got != tc.want[i] {
+				t.Errorf("%s: page %d has color %v, want %v", tc.direction, i, got, tc.want[i])
+			}
+		}
+	}
+}
+
+func TestMergePagesReadingOrder(t *testing.T) {
+	first := solidPage(80, 100, red)
+	second := solidPage(80, 100, blue)
+
+	tests := []struct {
+		direction   string
+		left, right color.RGBA
+	}{
+		{ReadingRTL, blue, red},
+		{ReadingLTR, red, blue},
+		{"", blue, red},
+	}
+	for _, tc := range tests {
+		config := DefaultConfig()
+		config.Processing.Spreads = SpreadsMerge
+		config.Processing.ReadingDirection = tc.direction
+		p := NewPDFGenerator(config)
+
+		pages := p.mergePages(pngSource(t, first, 1), pngSource(t, second, 2))
+		if len(pages) != 1 || pages[0].Width != 160 || pages[0].Height != 100 {
+			t.Fatalf("%s: merged into %v, want one 160x100 page", tc.direction, pages)
+		}
+		if got := pixelAt(t, pages[0], 20, 50); got != tc.left {
+			t.Errorf("%s: left half has color %v, want %v", tc.direction, got, tc.left)
+		}
+		if got := pixelAt(t, pages[0], 140, 50); got != tc.right {
+			t.Errorf("%s: right half has color %v, want %v", tc.direction, got, tc.right)
+		}
+	}
+}
+
+func TestMergeSpreadScalesToShorterPage(t *testing.T) {
+	left := solidPage(80, 100, red)
+	right := solidPage(40, 50, blue)
+	if b := mergeSpread(left, right).Bounds(); b.Dx() != 80 || b.Dy() != 50 {
+		t.Errorf("merged spread is %dx%d, want 80x50", b.Dx(), b.Dy())
+	}
+}
+
+func TestLayoutPageMergePairs(t *testing.T) {
+	config := DefaultConfig()
+	config.Processing.Spreads = SpreadsMerge
+	p := NewPDFGenerator(config)
+
+	single := solidPage(80, 100, red)
+	spread := solidPage(160, 100, blue)
+
+	// The cover stays single, pages 2 and 3 are merged, the spread on
+	// page 4 is kept and page 5 is left over at the end
+	tests := []struct {
+		img    image.Image
+		widths []int
+	}{
+		{single, []int{80}},
+		{single, nil},
+		{single, []int{160}},
+		{spread, []int{160}},
+		{single, nil},
+	}
+	var pending *pageSource
+	for i, tc := range tests {
+		pages := p.layoutPage(pngSource(t, tc.img, i+1), &pending, i == 0)
+		if len(pages) != len(tc.widths) {
+			t.Fatalf("page %d: laid out %d pages, want %d", i+1, len(pages), len(tc.widths))
+		}
+		for j, page := range pages {
+			if page.Width != tc.widths[j] {
+				t.Errorf("page %d: output %d is %d wide, want %d", i+1, j, page.Width, tc.widths[j])
+			}
+		}
+	}
+	if last := p.flushPending(&pending); len(last) != 1 || last[0].Width != 80 {
+		t.Errorf("left-over page flushed as %v, want one single page", last)
+	}
+}
@@ -0,0 +1,266 @@
+package main
+
+import (
+	"image"
+	"image/draw"
+	"os"
+	"sort"
+)
+
+// Long-strip detection and cutting
+const (
+	defaultStripPageRatio = 1.414 // A4 portrait
+	stripSliceRatio       = 1.8   // Median height to width ratio from which pages are treated as strip slices
+	stripSameWidth        = 0.9   // Share of slices that must have the same width
+	stripMinSlices        = 3
+	stripCutWindow        = 0.15 // A cut may move this share of the page height to find a quiet row
+)
+
+// detectLongStrip reports whether the pages look like slices of a
+// vertical-scroll comic: nearly all share one width and are tall
+func detectLongStrip(images []DownloadedImage) bool {
+	widths := make(map[int]int)
+	ratios := make([]float64, 0, len(images))
+	for _, img := range images {
+		if img.Missing {
+			continue
+		}
+		cfg, err := decodeImageConfig(img.Path)
+		if err != nil || cfg.Width == 0 {
+			continue
+		}
+		widths[cfg.Width]++
+		ratios = append(ratios, float64(cfg.Height)/float64(cfg.Width))
+	}
+	if len(ratios) < stripMinSlices {
+		return false
+	}
+
+	most := 0
+	for _, n := range widths {
+		if n > most {
+			most = n
+		}
+	}
+	if float64(most) < float64(len(ratios))*stripSameWidth {
+		return false
+	}
+
+	sort.Float64s(ratios)
+	return ratios[len(ratios)/2] >= stripSliceRatio
+}
+
+// decodeImageConfig reads the dimensions of an image file
+func decodeImageConfig(path string) (image.Config, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return image.Config{}, err
+	}
+	defer file.Close()
+
+	cfg, _, err := image.DecodeConfig(file)
+	return cfg, err
+}
+
+// stripBuilder stitches consecutive slices of equal width and cuts the
+// result into pages of a fixed aspect ratio
+type stripBuilder struct {
+	ratio    float64
+	buf      *image.RGBA  // Stitched rows not cut into pages yet
+	lossless bool         // Every slice in buf came from a lossless file
+	slices   []stripSlice // Source pages with rows in buf
+}
+
+// stripSlice is where a source page lies in the buffer
+type stripSlice struct {
+	page   int
+	top    int // May be negative once the page's first rows were cut off
+	height int
+}
+
+// newStripBuilder creates a builder for pages of height = width * ratio
+func newStripBuilder(ratio float64) *stripBuilder {
+	return &stripBuilder{ratio: ratio}
+}
+
+// stripPage is a page cut from a strip with the source format to encode
+// it as
+type stripPage struct {
+	img    image.Image
+	format string
+	pages  []int // Source pages with rows on this page
+}
+
+// page wraps the first rows of the buffer up to img's height as a page
+func (b *stripBuilder) page(img image.Image) stripPage {
+	height := img.Bounds().Dy()
+	var pages []int
+	for _, slice := range b.slices {
+		if slice.top < height {
+			pages = append(pages, slice.page)
+		}
+	}
+
+	format := "jpeg"
+	if b.lossless {
+		format = "png"
+	}
+	return stripPage{img: img, format: format, pages: pages}
+}
+
+// add appends a slice from the given source page and returns the pages
+// that are complete. A slice of a different width ends the current strip
+// and starts a new one.
+func (b *stripBuilder) add(img image.Image, format string, page int) []stripPage {
+	var pages []stripPage
+	bounds := img.Bounds()
+	if b.buf != nil && b.buf.Bounds().Dx() != bounds.Dx() {
+		pages = b.flush()
+	}
+
+	lossless := format == "png" || format == "gif"
+	if b.buf == nil {
+		b.lossless = lossless
+		b.buf = image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+		draw.Draw(b.buf, b.buf.Bounds(), img, bounds.Min, draw.Src)
+		b.slices = []stripSlice{{page: page, height: bounds.Dy()}}
+	} else {
+		b.lossless = b.lossless && lossless
+		height := b.buf.Bounds().Dy()
+		grown := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), height+bounds.Dy()))
+		copy(grown.Pix, b.buf.Pix)
+		draw.Draw(grown, image.Rect(0, height, bounds.Dx(), height+bounds.Dy()), img, bounds.Min, draw.Src)
+		b.buf = grown
+		b.slices = append(b.slices, stripSlice{page: page, top: height, height: bounds.Dy()})
+	}
+
+	pageHeight, window := b.pageHeight()
+	for b.buf.Bounds().Dy() > pageHeight+window {
+		pages = append(pages, b.cut(pageHeight, window))
+	}
+	return pages
+}
+
+// flush cuts everything left into pages and ends the strip
+func (b *stripBuilder) flush() []stripPage {
+	if b.buf == nil {
+		return nil
+	}
+
+	var pages []stripPage
+	pageHeight, window := b.pageHeight()
+	for b.buf.Bounds().Dy() > pageHeight+window {
+		pages = append(pages, b.cut(pageHeight, window))
+	}
+	if b.buf.Bounds().Dy() > 0 {
+		pages = append(pages, b.page(b.buf))
+	}
+	b.buf = nil
+	b.slices = nil
+	return pages
+}
+
+// pageHeight returns the target page height and how far a cut may move
+func (b *stripBuilder) pageHeight() (int, int) {
+	height := int(float64(b.buf.Bounds().Dx()) * b.ratio)
+	if height < 1 {
+		height = 1
+	}
+	return height, int(float64(height) * stripCutWindow)
+}
+
+// cut removes the first page from the buffer, cutting at the quietest row
+// near the target height so panels and text are not sliced through
+func (b *stripBuilder) cut(pageHeight, window int) stripPage {
+	y := quietRow(b.buf, pageHeight-window, pageHeight+window, pageHeight)
+
+	bounds := b.buf.Bounds()
+	page := b.page(b.buf.SubImage(image.Rect(0, 0, bounds.Dx(), y)))
+	rest := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()-y))
+	copy(rest.Pix, b.buf.Pix[y*b.buf.Stride:])
+	b.buf = rest
+
+	// Keep the slices that reach below the cut
+	slices := b.slices[:0]
+	for _, slice := range b.slices {
+		if slice.top+slice.height > y {
+			slice.top -= y
+			slices = append(slices, slice)
+		}
+	}
+	b.slices = slices
+	return page
+}
+
+// quietRow finds the row in [from, to] with the least horizontal detail,
+// preferring rows closer to target on ties
+func quietRow(img *image.RGBA, from, to, target int) int {
+	height := img.Bounds().Dy()
+	if from < 1 {
+		from = 1
+	}
+	if to > height-1 {
+		to = height - 1
+	}
+	if from > to {
+		return target
+	}
+
+	best, bestScore, bestDist := target, -1, 0
+	width := img.Bounds().Dx()
+	for y := from; y <= to; y++ {
+		row := img.Pix[y*img.Stride : y*img.Stride+width*4]
+		score := 0
+		prev := -1
+		for x := 0; x < width; x += 2 {
+			i := x * 4
+			lum := (int(row[i]) + 2*int(row[i+1]) + int(row[i+2])) / 4
+			if prev >= 0 {
+				if d := lum - prev; d > 0 {
+					score += d
+				} else {
+					score -= d
+				}
+			}
+			prev = lum
+		}
+
+		dist := y - target
+		if dist < 0 {
+			dist = -dist
+		}
+		if bestScore < 0 || score < bestScore || (score == bestScore && dist < bestDist) {
+			best, bestScore, bestDist = y, score, dist
+		}
+	}
+	return best
+}
+
+// stripPages adds a slice to the strip and encodes the pages it completes
+func (p *PDFGenerator) stripPages(strip *stripBuilder, src *pageSource) []PDFImage {
+	img, err := src.decode()
+	if err != nil {
+		p.skipPage(src.page, err)
+		return nil
+	}
+	return p.encodeStripPages(strip.add(img, src.format, src.page))
+}
+
+// encodeStripPages processes and encodes pages cut from a strip
+func (p *PDFGenerator) encodeStripPages(pages []stripPage) []PDFImage {
+	encoded := make([]PDFImage, 0, len(pages))
+	for _, page := range pages {
+		img, _ := processImage(page.img, p.config.Processing)
+		pdfPage, err := p.encodePage(img, page.format)
+		if err != nil {
+			// The slices on this page are lost with it
+			for _, n := range page.pages {
+				p.skipPage(n, err)
+			}
+			continue
+		}
+		pdfPage.Sources = page.pages
+		encoded = append(encoded, pdfPage)
+	}
+	return encoded
+}
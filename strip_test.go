@@ -0,0 +1,141 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// busySlice returns a slice of vertical stripes with white gutter rows, so
+// only the gutters are quiet enough to cut at
+func busySlice(width, height int, gutters ...int) *image.RGBA {
+	img := solidPage(width, height, white)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			if (x/2)%2 == 0 {
+				img.SetRGBA(x, y, black)
+			}
+		}
+	}
+	for _, y := range gutters {
+		for x := 0; x < width; x++ {
+			img.SetRGBA(x, y, white)
+		}
+	}
+	return img
+}
+
+func TestQuietRow(t *testing.T) {
+	tests := []struct {
+		name     string
+		img      *image.RGBA
+		from, to int
+		want     int
+	}{
+		{"gutter in window", busySlice(100, 300, 90), 85, 115, 90},
+		{"no gutter", busySlice(100, 300), 85, 115, 100},
+		{"gutter outside window", busySlice(100, 300, 60), 85, 115, 100},
+		{"nearest gutter wins", busySlice(100, 300, 88, 108), 85, 115, 108},
+		{"window past the end", busySlice(100, 50), 85, 115, 100},
+	}
+	for _, tc := range tests {
+		if got := quietRow(tc.img, tc.from, tc.to, 100); got != tc.want {
+			t.Errorf("%s: cut at %d, want %d", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestStripBuilderCutPoints(t *testing.T) {
+	// Pages are as tall as they are wide: 100 rows, cut within 85-115
+	b := newStripBuilder(1)
+
+	type cut struct {
+		height int
+		pages  []int
+	}
+	tests := []struct {
+		slice *image.RGBA
+		want  []cut
+	}{
+		{busySlice(100, 120, 95), []cut{{95, []int{1}}}},
+		// Buffer row 105 is row 80 of the second slice
+		{busySlice(100, 120, 80), []cut{{105, []int{1, 2}}}},
+		{busySlice(100, 120), []cut{{100, []int{2, 3}}}},
+	}
+	for i, tc := range tests {
+		pages := b.add(tc.slice, "png", i+1)
+		var got []cut
+		for _, page := range pages {
+			got = append(got, cut{page.img.Bounds().Dy(), page.pages})
+			if page.format != "png" {
+				t.Errorf("slice %d: page format %q, want png", i+1, page.format)
+			}
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("slice %d: cut %v, want %v", i+1, got, tc.want)
+		}
+	}
+
+	last := b.flush()
+	if len(last) != 1 || last[0].img.Bounds().Dy() != 60 || !reflect.DeepEqual(last[0].pages, []int{3}) {
+		t.Errorf("flushed %d pages, want the last 60 rows of slice 3", len(last))
+	}
+}
+
+func TestStripBuilderWidthChangeEndsStrip(t *testing.T) {
+	b := newStripBuilder(1)
+	if pages := b.add(busySlice(100, 50), "jpeg", 1); len(pages) != 0 {
+		t.Fatalf("short slice cut into %d pages", len(pages))
+	}
+	pages := b.add(busySlice(80, 50), "png", 2)
+	if len(pages) != 1 || pages[0].img.Bounds().Dx() != 100 || pages[0].format != "jpeg" {
+		t.Fatalf("new width did not end the strip: %d pages", len(pages))
+	}
+	last := b.flush()
+	if len(last) != 1 || last[0].img.Bounds().Dx() != 80 || last[0].format != "png" {
+		t.Errorf("second strip flushed as %d pages", len(last))
+	}
+}
+
+func TestDetectLongStrip(t *testing.T) {
+	type slice struct {
+		width, height int
+		missing       bool
+	}
+	repeat := func(n int, s slice) []slice {
+		slices := make([]slice, n)
+		for i := range slices {
+			slices[i] = s
+		}
+		return slices
+	}
+
+	tests := []struct {
+		name   string
+		slices []slice
+		want   bool
+	}{
+		{"tall slices", repeat(5, slice{60, 180, false}), true},
+		{"book pages", repeat(5, slice{60, 85, false}), false},
+		{"too few slices", repeat(2, slice{60, 180, false}), false},
+		{"mixed widths", append(repeat(3, slice{60, 180, false}), repeat(2, slice{80, 240, false})...), false},
+		{"missing pages ignored", append(repeat(4, slice{60, 180, false}), slice{40, 40, true}), true},
+	}
+	for _, tc := range tests {
+		dir := t.TempDir()
+		images := make([]DownloadedImage, len(tc.slices))
+		for i, s := range tc.slices {
+			path := filepath.Join(dir, fmt.Sprintf("%04d.png", i))
+			if err := os.WriteFile(path, testPageData(t, s.width, s.height, "png"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			images[i] = DownloadedImage{Index: i, Path: path, Missing: s.missing}
+		}
+		if got := detectLongStrip(images); got != tc.want {
+			t.Errorf("%s: detectLongStrip = %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,285 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	"os"
+	"strings"
+	"unicode"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/font/sfnt"
+	"golang.org/x/image/math/fixed"
+)
+
+// Title page layout in pixels, A4 at 150 DPI like the other pages
+const (
+	titlePageWidth  = 1240
+	titlePageHeight = 1754
+	titleMargin     = 100
+	titleCoverMax   = 900 // Max cover height
+	titleFontSize   = 48
+	titleBodySize   = 30
+	titleMaxLines   = 3 // Longer titles are cut off
+)
+
+// titleLabels are the captions of the album details
+type titleLabels struct {
+	author, tags, pages, separator string
+}
+
+var (
+	titleLabelsCJK   = titleLabels{author: "作者：", tags: "标签：", pages: "页数：", separator: "、"}
+	titleLabelsLatin = titleLabels{author: "Author: ", tags: "Tags: ", pages: "Pages: ", separator: ", "}
+)
+
+// errTitleGlyphs is returned when the title font cannot draw the album
+// details, usually CJK text with the built-in font
+var errTitleGlyphs = errors.New("title font has no glyphs for the album details")
+
+// titleFonts are the faces used on the title page
+type titleFonts struct {
+	title font.Face
+	body  font.Face
+}
+
+// loadTitleFonts loads the configured font, falling back to the built-in
+// Go font, which has no CJK glyphs
+func loadTitleFonts(path string) (*titleFonts, error) {
+	data := goregular.TTF
+	var loadErr error
+	if path != "" {
+		if fontData, err := os.ReadFile(path); err == nil {
+			data = fontData
+		} else {
+			loadErr = err
+		}
+	}
+
+	f, err := parseFont(data)
+	if err != nil {
+		loadErr = err
+		if f, err = parseFont(goregular.TTF); err != nil {
+			return nil, err
+		}
+	}
+
+	title, err := opentype.NewFace(f, &opentype.FaceOptions{Size: titleFontSize, DPI: 72, Hinting: font.HintingFull})
+	if err != nil {
+		return nil, err
+	}
+	body, err := opentype.NewFace(f, &opentype.FaceOptions{Size: titleBodySize, DPI: 72, Hinting: font.HintingFull})
+	if err != nil {
+		return nil, err
+	}
+	return &titleFonts{title: title, body: body}, loadErr
+}
+
+// checkTitleFont checks that the font at path loads and has CJK glyphs,
+// which the captions and most album details need
+func checkTitleFont(path string) error {
+	if path == "" {
+		return errors.New("no font set")
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	f, err := parseFont(data)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	face, err := opentype.NewFace(f, &opentype.FaceOptions{Size: titleBodySize, DPI: 72})
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	labels := titleLabelsCJK
+	if missing := missingGlyphs(face, 5, labels.author, labels.tags, labels.pages); len(missing) > 0 {
+		return fmt.Errorf("%s has no CJK glyphs (%q)", path, string(missing))
+	}
+	return nil
+}
+
+// missingGlyphs returns the distinct characters of texts that face has no
+// glyph for, at most limit of them
+func missingGlyphs(face font.Face, limit int, texts ...string) []rune {
+	missing := make([]rune, 0)
+	seen := make(map[rune]bool)
+	for _, text := range texts {
+		for _, r := range text {
+			if seen[r] || unicode.IsSpace(r) || !unicode.IsPrint(r) {
+				continue
+			}
+			seen[r] = true
+			if _, ok := face.GlyphAdvance(r); !ok {
+				missing = append(missing, r)
+				if len(missing) == limit {
+					return missing
+				}
+			}
+		}
+	}
+	return missing
+}
+
+// parseFont parses a font file or the first font of a collection
+func parseFont(data []byte) (*sfnt.Font, error) {
+	if f, err := opentype.Parse(data); err == nil {
+		return f, nil
+	}
+	collection, err := opentype.ParseCollection(data)
+	if err != nil {
+		return nil, err
+	}
+	return collection.Font(0)
+}
+
+// renderTitlePage draws the cover and the album details on a white page.
+// cover may be nil.
+func renderTitlePage(comic *Comic, pages int, cover image.Image, fonts *titleFonts) image.Image {
+	page := image.NewRGBA(image.Rect(0, 0, titlePageWidth, titlePageHeight))
+	draw.Draw(page, page.Bounds(), image.White, image.Point{}, draw.Src)
+
+	y := titleMargin
+	width := titlePageWidth - 2*titleMargin
+	if cover != nil {
+		bounds := cover.Bounds()
+		w, h := bounds.Dx(), bounds.Dy()
+		if w > width {
+			h = h * width / w
+			w = width
+		}
+		if h > titleCoverMax {
+			w = w * titleCoverMax / h
+			h = titleCoverMax
+		}
+		x := (titlePageWidth - w) / 2
+		drawScaled(page, image.Rect(x, y, x+w, y+h), cover)
+		y += h + titleMargin/2
+	}
+
+	title := comic.Title
+	if title == "" {
+		title = "JM" + comic.ID
+	}
+	lines := wrapText(fonts.title, title, width)
+	if len(lines) > titleMaxLines {
+		lines = lines[:titleMaxLines]
+		lines[titleMaxLines-1] += "…"
+	}
+	for _, line := range lines {
+		y += lineHeight(fonts.title)
+		drawText(page, fonts.title, line, (titlePageWidth-font.MeasureString(fonts.title, line).Ceil())/2, y)
+	}
+	y += titleMargin / 3
+
+	// Fonts without CJK glyphs would draw the Chinese captions as boxes
+	labels := titleLabelsCJK
+	if _, ok := fonts.body.GlyphAdvance('作'); !ok {
+		labels = titleLabelsLatin
+	}
+	details := make([]string, 0, 4)
+	if comic.Author != "" {
+		details = append(details, labels.author+comic.Author)
+	}
+	if len(comic.Tags) > 0 {
+		details = append(details, labels.tags+strings.Join(comic.Tags, labels.separator))
+	}
+	details = append(details, fmt.Sprintf("%s%d", labels.pages, pages))
+	details = append(details, "ID: JM"+comic.ID)
+
+	for _, detail := range details {
+		for _, line := range wrapText(fonts.body, detail, width) {
+			y += lineHeight(fonts.body)
+			if y > titlePageHeight-titleMargin {
+				return page
+			}
+			drawText(page, fonts.body, line, titleMargin, y)
+		}
+	}
+	return page
+}
+
+// wrapText breaks text into lines no wider than width, preferring breaks
+// at spaces
+func wrapText(face font.Face, text string, width int) []string {
+	limit := fixed.I(width)
+	lines := make([]string, 0, 1)
+	line := make([]rune, 0)
+	for _, r := range text {
+		line = append(line, r)
+		if font.MeasureString(face, string(line)) <= limit || len(line) == 1 {
+			continue
+		}
+
+		// Move the last word to the next line if there is a space to break at
+		cut := len(line) - 1
+		if r != ' ' {
+			for i := cut - 1; i > 0; i-- {
+				if line[i] == ' ' {
+					cut = i + 1
+					break
+				}
+			}
+		}
+		lines = append(lines, strings.TrimRight(string(line[:cut]), " "))
+		line = []rune(strings.TrimLeft(string(line[cut:]), " "))
+	}
+	if len(line) > 0 {
+		lines = append(lines, string(line))
+	}
+	return lines
+}
+
+// lineHeight returns the distance between baselines of a face
+func lineHeight(face font.Face) int {
+	return face.Metrics().Height.Ceil() * 5 / 4
+}
+
+// drawText draws a line of black text with its baseline at y
+func drawText(dst draw.Image, face font.Face, text string, x, y int) {
+	d := font.Drawer{
+		Dst:  dst,
+		Src:  image.Black,
+		Face: face,
+		Dot:  fixed.P(x, y),
+	}
+	d.DrawString(text)
+}
+
+// renderTitle renders the title page for an album as a PDF page. The cover
+// is the first page that downloaded. It returns errTitleGlyphs if the font
+// cannot draw the title, author or tags.
+func (p *PDFGenerator) renderTitle(comic *Comic, images []DownloadedImage) (PDFImage, error) {
+	fonts, err := loadTitleFonts(p.config.TitleFont)
+	if fonts == nil {
+		return PDFImage{}, fmt.Errorf("failed to load title font: %w", err)
+	}
+	if err != nil {
+		p.logf("warn", "Title font %s not usable, using the built-in font: %v", p.config.TitleFont, err)
+	}
+	if missing := missingGlyphs(fonts.body, 5, comic.Title, comic.Author, strings.Join(comic.Tags, " ")); len(missing) > 0 {
+		return PDFImage{}, fmt.Errorf("%w (%q)", errTitleGlyphs, string(missing))
+	}
+
+	var cover image.Image
+	for _, img := range images {
+		if img.Missing {
+			continue
+		}
+		if src, err := readPage(img.Path); err == nil {
+			cover, _ = src.decode()
+		}
+		break
+	}
+
+	pages := comic.Pages
+	if pages == 0 {
+		pages = len(images)
+	}
+	return jpegImage(renderTitlePage(comic, pages, cover, fonts), p.config.JPEGQuality())
+}
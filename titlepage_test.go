@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+)
+
+// buildWithTitle builds a title page PDF of a small album with the
+// built-in font and returns the file and the logged errors
+func buildWithTitle(t *testing.T, comic *Comic) (string, []string) {
+	t.Helper()
+	dir := t.TempDir()
+	albumDir := filepath.Join(dir, comic.ID)
+	if err := os.MkdirAll(albumDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	images := writeTestAlbum(t, albumDir, 3, 60, 80)
+
+	config := DefaultConfig()
+	config.BaseDir = dir
+	config.TitlePage = true
+	gen := NewPDFGenerator(config)
+	var errs []string
+	gen.SetLogger(func(level, message string) {
+		if level == "error" {
+			errs = append(errs, message)
+		}
+	})
+
+	files, err := gen.CreatePDFWithTitle(context.Background(), comic, images)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 {
+		t.Fatalf("got %d files, want 1", len(files))
+	}
+	if name := gen.UploadName(comic, files[0]); name != comic.ID+".pdf" {
+		t.Errorf("upload name %q, want %s.pdf", name, comic.ID)
+	}
+	return files[0], errs
+}
+
+func TestCreatePDFWithTitleLatin(t *testing.T) {
+	file, errs := buildWithTitle(t, &Comic{ID: "100", Title: "Latin title", Author: "Someone", Tags: []string{"tag"}})
+	if len(errs) > 0 {
+		t.Errorf("unexpected errors: %v", errs)
+	}
+	if !strings.HasSuffix(file, "-title.pdf") {
+		t.Errorf("file %s is not named as having a title page", file)
+	}
+	if n, err := api.PageCountFile(file); err != nil || n != 4 {
+		t.Fatalf("page count %d (%v), want the title page and 3 pages", n, err)
+	}
+}
+
+func TestCreatePDFWithTitleSkipsPageWithoutGlyphs(t *testing.T) {
+	file, errs := buildWithTitle(t, &Comic{ID: "200", Title: "中文标题", Author: "作者"})
+	if len(errs) != 1 || !strings.Contains(errs[0], "Skipping the title page") {
+		t.Errorf("logged errors %v, want one about the skipped title page", errs)
+	}
+
+	// The name depends only on the settings, so other requesters with the
+	// same settings reuse this file instead of rendering the page again
+	config := DefaultConfig()
+	config.TitlePage = true
+	if want := "200" + NewPDFGenerator(config).Variant() + ".pdf"; filepath.Base(file) != want {
+		t.Errorf("file %s, want %s", filepath.Base(file), want)
+	}
+	if n, err := api.PageCountFile(file); err != nil || n != 3 {
+		t.Fatalf("page count %d (%v), want 3 pages without a title page", n, err)
+	}
+}
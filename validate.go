@@ -0,0 +1,47 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// ValidateImageData checks that data is a complete image of at least
+// minSize x minSize pixels and returns the decoded image and its format
+func ValidateImageData(data []byte, minSize int) (image.Image, string, error) {
+	if len(data) == 0 {
+		return nil, "", fmt.Errorf("empty image data")
+	}
+
+	// Catch HTML error pages and other non-image bodies before decoding
+	contentType := http.DetectContentType(data)
+	if !strings.HasPrefix(contentType, "image/") {
+		return nil, "", fmt.Errorf("not an image (content type %s)", contentType)
+	}
+
+	// A full decode catches truncated files
+	img, format, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to decode %s: %w", contentType, err)
+	}
+
+	bounds := img.Bounds()
+	if bounds.Dx() < minSize || bounds.Dy() < minSize {
+		return nil, "", fmt.Errorf("image too small (%dx%d)", bounds.Dx(), bounds.Dy())
+	}
+
+	return img, format, nil
+}
+
+// ValidateImageFile checks a saved image file with ValidateImageData
+func ValidateImageFile(path string, minSize int) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	_, _, err = ValidateImageData(data, minSize)
+	return err
+}
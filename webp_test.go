@@ -0,0 +1,172 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+)
+
+// WebP fixtures, taken from the golang.org/x/image test data
+var webpFixtures = []struct {
+	name          string
+	path          string
+	width, height int
+}{
+	{"lossy", "testdata/page.lossy.webp", 150, 100},
+	{"lossless", "testdata/page.lossless.webp", 75, 100},
+}
+
+func readFixture(t testing.TB, path string) []byte {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// meanDiff returns the mean absolute difference of two RGBA pixel buffers
+func meanDiff(a, b []byte) float64 {
+	if len(a) != len(b) || len(a) == 0 {
+		return 255
+	}
+	var sum int
+	for i := range a {
+		d := int(a[i]) - int(b[i])
+		if d < 0 {
+			d = -d
+		}
+		sum += d
+	}
+	return float64(sum) / float64(len(a))
+}
+
+func TestValidateImageDataWebP(t *testing.T) {
+	for _, f := range webpFixtures {
+		data := readFixture(t, f.path)
+
+		img, format, err := ValidateImageData(data, 50)
+		if err != nil {
+			t.Fatalf("%s: %v", f.name, err)
+		}
+		if format != "webp" {
+			t.Errorf("%s: format %q, want webp", f.name, format)
+		}
+		if b := img.Bounds(); b.Dx() != f.width || b.Dy() != f.height {
+			t.Errorf("%s: size %dx%d, want %dx%d", f.name, b.Dx(), b.Dy(), f.width, f.height)
+		}
+
+		if _, _, err := ValidateImageData(data[:len(data)/2], 50); err == nil {
+			t.Errorf("%s: truncated file passed validation", f.name)
+		}
+		if _, _, err := ValidateImageData(data, 200); err == nil {
+			t.Errorf("%s: image below the minimum size passed validation", f.name)
+		}
+	}
+}
+
+func TestDescrambleWebP(t *testing.T) {
+	client := NewJMClient(DefaultConfig())
+	for _, f := range webpFixtures {
+		data := readFixture(t, f.path)
+		src, _, err := image.Decode(bytes.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, tc := range []struct {
+			name     string
+			chapter  *Chapter
+			segments int
+		}{
+			{"unscrambled", &Chapter{ID: "200000", ScrambleID: "220980"}, 0},
+			{"scrambled", &Chapter{ID: "250000", ScrambleID: "220980"}, 10},
+		} {
+			decoded, err := client.DecodeScrambledImage(data, tc.chapter, "00001.webp")
+			if err != nil {
+				t.Fatalf("%s %s: %v", f.name, tc.name, err)
+			}
+
+			// PDFs cannot embed WebP, so every page comes out as JPEG
+			img, format, err := image.Decode(bytes.NewReader(decoded))
+			if err != nil {
+				t.Fatalf("%s %s: %v", f.name, tc.name, err)
+			}
+			if format != "jpeg" {
+				t.Errorf("%s %s: format %q, want jpeg", f.name, tc.name, format)
+			}
+			if img.Bounds() != src.Bounds() {
+				t.Errorf("%s %s: bounds %v, want %v", f.name, tc.name, img.Bounds(), src.Bounds())
+			}
+
+			want := src
+			if tc.segments > 0 {
+				want = descrambleRows(src, tc.segments)
+			}
+			if d := meanDiff(rgbaPix(img), rgbaPix(want)); d > 8 {
+				t.Errorf("%s %s: mean pixel difference %.1f from the expected page", f.name, tc.name, d)
+			}
+		}
+	}
+}
+
+func TestPreparePageWebP(t *testing.T) {
+	p := NewPDFGenerator(DefaultConfig())
+	for _, f := range webpFixtures {
+		src, err := readPage(f.path)
+		if err != nil {
+			t.Fatalf("%s: %v", f.name, err)
+		}
+		if src.format != "webp" || src.width != f.width || src.height != f.height {
+			t.Errorf("%s: read %s %dx%d, want webp %dx%d", f.name, src.format, src.width, src.height, f.width, f.height)
+		}
+
+		page, err := p.preparePage(src)
+		if err != nil {
+			t.Fatalf("%s: %v", f.name, err)
+		}
+		if page.Filter != "FlateDecode" || page.Components != 3 {
+			t.Errorf("%s: page encoded as %s with %d components, want FlateDecode RGB", f.name, page.Filter, page.Components)
+		}
+		if page.Width != f.width || page.Height != f.height {
+			t.Errorf("%s: page %dx%d, want %dx%d", f.name, page.Width, page.Height, f.width, f.height)
+		}
+	}
+}
+
+func TestCreatePDFWithWebPPages(t *testing.T) {
+	dir := t.TempDir()
+	comic := &Comic{ID: "webp"}
+	albumDir := filepath.Join(dir, comic.ID)
+	if err := os.MkdirAll(albumDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	images := make([]DownloadedImage, len(webpFixtures))
+	for i, f := range webpFixtures {
+		data := readFixture(t, f.path)
+		path := filepath.Join(albumDir, filepath.Base(f.path))
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		images[i] = DownloadedImage{Index: i, Path: path, Size: int64(len(data)), Filename: filepath.Base(path)}
+	}
+
+	config := DefaultConfig()
+	config.BaseDir = dir
+	files, err := NewPDFGenerator(config).CreatePDF(context.Background(), comic, images)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := api.ValidateFile(files[0], nil); err != nil {
+		t.Fatalf("invalid PDF: %v", err)
+	}
+	if n, err := api.PageCountFile(files[0]); err != nil || n != len(images) {
+		t.Fatalf("page count %d (%v), want %d", n, err, len(images))
+	}
+}